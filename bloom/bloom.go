@@ -4,43 +4,75 @@ import (
 	"context"
 	"errors"
 	"strconv"
-  "github.com/spaolacci/murmur3"
+	"sync/atomic"
+
 	"github.com/redis/go-redis/v9"
+	"github.com/spaolacci/murmur3"
 )
 
 // for detailed error rate table, see http://pages.cs.wisc.edu/~cao/papers/summary-cache/node8.html
 // maps as k in the error rate table
 const maps = 14
 
+// batchSize is how many items are sent in one script call by the batch methods,
+// all calls of a batch are sent in one pipeline.
+const batchSize = 1000
+
 var (
 	// ErrTooLargeOffset indicates the offset is too large in bitset.
 	ErrTooLargeOffset = errors.New("too large offset")
 
-	setScript = `
+	// scripts are sent with EVALSHA, and loaded on NOSCRIPT.
+	setScript = redis.NewScript(`
 for _, offset in ipairs(ARGV) do
 	redis.call("setbit", KEYS[1], offset, 1)
 end
-`
-	testScript = `
+`)
+	testScript = redis.NewScript(`
 for _, offset in ipairs(ARGV) do
 	if tonumber(redis.call("getbit", KEYS[1], offset)) == 0 then
 		return false
 	end
 end
 return true
-`
+`)
+	// testManyScript checks items of ARGV[1] offsets each, returns 1 or 0 for each item.
+	testManyScript = redis.NewScript(`
+local maps = tonumber(ARGV[1])
+local result = {}
+for i = 2, #ARGV, maps do
+	local exists = 1
+	for j = i, i + maps - 1 do
+		if tonumber(redis.call("getbit", KEYS[1], ARGV[j])) == 0 then
+			exists = 0
+			break
+		end
+	end
+	result[#result + 1] = exists
+end
+return result
+`)
 )
 
 type (
 	// A Filter is a bloom filter.
 	Filter struct {
-		bits   uint
+		bits    uint
+		maps    uint
+		version HashVersion
+		// shards is how many parts bits are split into, all locations of an item are in one shard.
+		shards uint
 		bitSet bitSetProvider
+		// alert is the *statsAlert set by SetAlert.
+		alert atomic.Value
 	}
 
 	bitSetProvider interface {
 		check(ctx context.Context, offsets []uint) (bool, error)
 		set(ctx context.Context, offsets []uint) error
+		checkMany(ctx context.Context, offsets [][]uint) ([]bool, error)
+		setMany(ctx context.Context, offsets [][]uint) error
+		count(ctx context.Context) (uint64, error)
 	}
 )
 
@@ -50,10 +82,22 @@ type (
 // elements - means how many actual elements
 // when maps = 14, formula: 0.7*(bits/maps), bits = 20*elements, the error rate is 0.000067 < 1e-4
 // for detailed error rate table, see http://pages.cs.wisc.edu/~cao/papers/summary-cache/node8.html
+// The filter uses HashV1 to stay compatible with existing filters in redis.
 func New(store *redis.Client, key string, bits uint) *Filter {
+	return newRedisFilter(store, key, bits, maps, HashV1)
+}
+
+// NewWithHashVersion is like New but computes locations with the given hash version.
+func NewWithHashVersion(store *redis.Client, key string, bits uint, version HashVersion) *Filter {
+	return newRedisFilter(store, key, bits, maps, version)
+}
+
+func newRedisFilter(store *redis.Client, key string, bits, maps uint, version HashVersion) *Filter {
 	return &Filter{
-		bits:   bits,
-		bitSet: newRedisBitSet(store, key, bits),
+		bits:    bits,
+		maps:    maps,
+		version: version,
+		bitSet:  newRedisBitSet(store, key, bits),
 	}
 }
 
@@ -84,11 +128,62 @@ func (f *Filter) ExistsCtx(ctx context.Context, data []byte) (bool, error) {
 	return isSet, nil
 }
 
+// AddMany adds all data into f in one round trip.
+func (f *Filter) AddMany(data [][]byte) error {
+	return f.AddManyCtx(context.Background(), data)
+}
+
+// AddManyCtx adds all data into f in one round trip with context.
+func (f *Filter) AddManyCtx(ctx context.Context, data [][]byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return f.bitSet.setMany(ctx, f.getManyLocations(data))
+}
+
+// ExistsMany checks each of data is in f in one round trip,
+// the result has the same order as data.
+func (f *Filter) ExistsMany(data [][]byte) ([]bool, error) {
+	return f.ExistsManyCtx(context.Background(), data)
+}
+
+// ExistsManyCtx checks each of data is in f in one round trip with context.
+func (f *Filter) ExistsManyCtx(ctx context.Context, data [][]byte) ([]bool, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	return f.bitSet.checkMany(ctx, f.getManyLocations(data))
+}
+
+func (f *Filter) getManyLocations(data [][]byte) [][]uint {
+	locations := make([][]uint, len(data))
+	for i, item := range data {
+		locations[i] = f.getLocations(item)
+	}
+
+	return locations
+}
+
 func (f *Filter) getLocations(data []byte) []uint {
-	locations := make([]uint, maps)
-	for i := uint(0); i < maps; i++ {
-		hashValue := Hash(append(data, byte(i)))
-		locations[i] = uint(hashValue % uint64(f.bits))
+	bits := f.bits
+	if f.shards > 1 {
+		bits /= f.shards
+	}
+
+	locations := make([]uint, f.maps)
+	if f.version == HashV1 {
+		locationsV1(locations, data, bits)
+	} else {
+		locationsV2(locations, data, bits)
+	}
+
+	if f.shards > 1 {
+		base := shardOf(data, f.shards) * bits
+		for i := range locations {
+			locations[i] += base
+		}
 	}
 
 	return locations
@@ -127,7 +222,7 @@ func (r *redisBitSet) check(ctx context.Context, offsets []uint) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	resp, err := r.store.Eval(ctx, testScript, []string{r.key}, args...).Result()
+	resp, err := testScript.Run(ctx, r.store, []string{r.key}, args...).Result()
 	if err == redis.Nil {
 		return false, nil
 	} else if err != nil {
@@ -159,7 +254,7 @@ func (r *redisBitSet) set(ctx context.Context, offsets []uint) error {
 		return err
 	}
 
-	_, err = r.store.Eval(ctx, setScript, []string{r.key}, args...).Result()
+	_, err = setScript.Run(ctx, r.store, []string{r.key}, args...).Result()
 	if err == redis.Nil {
 		return nil
 	}
@@ -167,6 +262,142 @@ func (r *redisBitSet) set(ctx context.Context, offsets []uint) error {
 	return err
 }
 
+func (r *redisBitSet) checkMany(ctx context.Context, offsets [][]uint) ([]bool, error) {
+	items, err := r.buildItemArgs(offsets)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := chunkItems(r.key, items, nil, strconv.Itoa(len(offsets[0])))
+	return checkBatches(ctx, r.store, batches, len(offsets))
+}
+
+func (r *redisBitSet) setMany(ctx context.Context, offsets [][]uint) error {
+	items, err := r.buildItemArgs(offsets)
+	if err != nil {
+		return err
+	}
+
+	_, err = evalBatches(ctx, r.store, setScript, chunkItems(r.key, items, nil))
+	return err
+}
+
+func (r *redisBitSet) buildItemArgs(offsets [][]uint) ([][]interface{}, error) {
+	items := make([][]interface{}, len(offsets))
+	for i, item := range offsets {
+		args, err := r.buildOffsetArgs(item)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = args
+	}
+
+	return items, nil
+}
+
+// A scriptBatch is one script call on key for the items at indexes of a batch.
+type scriptBatch struct {
+	key     string
+	args    []interface{}
+	indexes []int
+}
+
+// chunkItems splits the args of items into batches of at most batchSize items on key,
+// head is put before the items of each batch. indexes are the positions of items
+// in the whole batch, nil means items are in order from 0.
+func chunkItems(key string, items [][]interface{}, indexes []int, head ...interface{}) []scriptBatch {
+	var batches []scriptBatch
+	for start := 0; start < len(items); start += batchSize {
+		end := start + batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		batch := scriptBatch{
+			key:  key,
+			args: append([]interface{}(nil), head...),
+		}
+		for i := start; i < end; i++ {
+			batch.args = append(batch.args, items[i]...)
+			if indexes == nil {
+				batch.indexes = append(batch.indexes, i)
+			} else {
+				batch.indexes = append(batch.indexes, indexes[i])
+			}
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// checkBatches runs testManyScript with batches, and puts the result of each item at its index.
+func checkBatches(ctx context.Context, store redis.UniversalClient, batches []scriptBatch, n int) ([]bool, error) {
+	cmds, err := evalBatches(ctx, store, testManyScript, batches)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]bool, n)
+	for i, cmd := range cmds {
+		values, err := cmd.Int64Slice()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(batches[i].indexes) {
+			return nil, errors.New("unexpected bloom batch response")
+		}
+		for j, v := range values {
+			result[batches[i].indexes[j]] = v == 1
+		}
+	}
+
+	return result, nil
+}
+
+// evalBatches runs script with each of batches in one pipeline using EVALSHA,
+// the batches failed with NOSCRIPT are retried once after the script is loaded,
+// which happens on the nodes without the script behind a cluster client.
+// The error of each command is checked, since the pipeline only returns the first one,
+// which can be the redis.Nil reply of a script returning nothing.
+func evalBatches(ctx context.Context, store redis.UniversalClient, script *redis.Script,
+	batches []scriptBatch) ([]*redis.Cmd, error) {
+	cmds := make([]*redis.Cmd, len(batches))
+	pending := make([]int, len(batches))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for retried := false; len(pending) > 0; retried = true {
+		pipe := store.Pipeline()
+		for _, i := range pending {
+			cmds[i] = script.EvalSha(ctx, pipe, []string{batches[i].key}, batches[i].args...)
+		}
+		// the errors are checked on each command
+		_, _ = pipe.Exec(ctx)
+
+		var noScript []int
+		for _, i := range pending {
+			if err := cmds[i].Err(); !retried && err != nil && redis.HasErrorPrefix(err, "NOSCRIPT") {
+				noScript = append(noScript, i)
+			}
+		}
+		if len(noScript) > 0 {
+			if err := script.Load(ctx, store).Err(); err != nil {
+				return nil, err
+			}
+		}
+		pending = noScript
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	return cmds, nil
+}
 
 // Hash returns the hash value of data.
 func Hash(data []byte) uint64 {
@@ -0,0 +1,222 @@
+// Command bloom builds bloom filters offline and moves them between snapshot files and redis.
+//
+//	bloom -in ids.txt -p 0.001 -out ids.bloom              build a snapshot from a newline-delimited file
+//	bloom -in ids.txt -p 0.001 -redis :6379 -key ids       build and load into redis
+//	bloom -load ids.bloom -redis :6379 -key ids            load a snapshot into redis
+//	bloom -redis :6379 -key ids -out ids.bloom             save a redis filter as a snapshot
+//	bloom -redis :6379 -key ids -bits 20000000 -out ids.bloom
+//	                                                       save a filter created by bloom.New, which has no meta
+//	bloom -load ids.bloom id1 id2                          check items
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"com"
+	"com/bloom"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	in   = flag.String("in", "", "newline-delimited items to build the filter from, - for stdin")
+	n    = flag.Uint("n", 0, "expected items, defaults to the lines of -in, required for stdin")
+	p    = flag.Float64("p", 0.001, "false positive rate")
+	load = flag.String("load", "", "snapshot file to load")
+	out  = flag.String("out", "", "snapshot file to write")
+	addr = flag.String("redis", "", "redis address")
+	pass = flag.String("pass", "", "redis password")
+	key  = flag.String("key", "", "redis key of the filter")
+	bits = flag.Uint("bits", 0, "bits of a redis filter without meta, like one created by bloom.New")
+	hash = flag.Uint("version", uint(bloom.HashV1), "hash version of a redis filter without meta")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: bloom [flags] [item ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx := context.Background()
+	var store *redis.Client
+	if *addr != "" {
+		if *key == "" {
+			fail(errors.New("-key is required with -redis"))
+		}
+		store = redis.NewClient(&redis.Options{Addr: *addr, Password: *pass})
+	}
+
+	f, err := source(ctx, store)
+	if err != nil {
+		fail(err)
+	}
+
+	if *out != "" {
+		if err := save(ctx, f, *out); err != nil {
+			fail(err)
+		}
+		com.ColorLog("[SUCC] saved to # %s #\n", *out)
+	}
+	if store != nil && (*in != "" || *load != "") {
+		if f, err = f.ToRedisCtx(ctx, store, *key); err != nil {
+			fail(err)
+		}
+		com.ColorLog("[SUCC] loaded into redis # %s #\n", *key)
+	}
+
+	for _, item := range flag.Args() {
+		exists, err := f.ExistsCtx(ctx, []byte(item))
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("%s\t%t\n", item, exists)
+	}
+}
+
+// source returns the filter built from -in, loaded from -load, or opened in redis.
+func source(ctx context.Context, store *redis.Client) (*bloom.Filter, error) {
+	switch {
+	case *in != "":
+		return build()
+	case *load != "":
+		file, err := os.Open(*load)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return bloom.Load(file)
+	case store != nil:
+		return open(ctx, store)
+	default:
+		return nil, errors.New("one of -in, -load or -redis is required")
+	}
+}
+
+// open opens the filter on -key with its meta, or with -bits and -version
+// if it has no meta, like one created by bloom.New.
+func open(ctx context.Context, store *redis.Client) (*bloom.Filter, error) {
+	f, err := bloom.OpenCtx(ctx, store, *key)
+	if !errors.Is(err, bloom.ErrMetaNotFound) {
+		return f, err
+	}
+	if *bits == 0 {
+		return nil, fmt.Errorf("%w, -bits is required for a filter created by bloom.New", err)
+	}
+
+	version := bloom.HashVersion(*hash)
+	if version != bloom.HashV1 && version != bloom.HashV2 {
+		return nil, fmt.Errorf("invalid -version %d", *hash)
+	}
+
+	return bloom.NewWithHashVersion(store, *key, *bits, version), nil
+}
+
+func build() (*bloom.Filter, error) {
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+
+		if *n == 0 {
+			lines, err := countLines(file)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			*n = lines
+		}
+	}
+	if *n == 0 {
+		return nil, errors.New("-n is required")
+	}
+
+	bits, maps, err := bloom.EstimateParameters(*n, *p)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("items=%d p=%g bits=%d maps=%d size=%dKB\n", *n, *p, bits, maps, (bits+8191)/8192)
+	// neither a snapshot nor a redis string can hold more bits
+	if uint64(bits) > bloom.MaxSnapshotBits {
+		return nil, fmt.Errorf("bits=%d exceeds %d, use a larger -p or split the items", bits,
+			uint64(bloom.MaxSnapshotBits))
+	}
+
+	f, err := bloom.NewLocalWithEstimates(*n, *p)
+	if err != nil {
+		return nil, err
+	}
+
+	var added uint
+	err = eachLine(r, func(line []byte) error {
+		added++
+		return f.Add(line)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if added > *n {
+		com.ColorLog("[WARN] added %d items, more than expected # %d #\n", added, *n)
+	}
+	fmt.Printf("added=%d\n", added)
+
+	return f, nil
+}
+
+func save(ctx context.Context, f *bloom.Filter, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := f.SaveCtx(ctx, file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func countLines(r io.Reader) (uint, error) {
+	var lines uint
+	err := eachLine(r, func([]byte) error {
+		lines++
+		return nil
+	})
+	return lines, err
+}
+
+// eachLine calls fn with each non-empty line of r, surrounding spaces are trimmed.
+func eachLine(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func fail(err error) {
+	com.ColorLog("[ERRO] %s\n", err)
+	os.Exit(1)
+}
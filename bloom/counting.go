@@ -0,0 +1,335 @@
+package bloom
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxCount is the saturated value of a 4-bit counter. A saturated counter is never
+// decremented, because the real count is unknown, so removals can't cause false negatives.
+const maxCount = 15
+
+var (
+	// counters are stored with BITFIELD u4, the counter at offset i is u4 #i.
+	incrScript = redis.NewScript(`
+for _, offset in ipairs(ARGV) do
+	local pos = "#" .. offset
+	local count = redis.call("bitfield", KEYS[1], "get", "u4", pos)[1]
+	if count < 15 then
+		redis.call("bitfield", KEYS[1], "set", "u4", pos, count + 1)
+	end
+end
+`)
+	// decrScript decrements only if all counters are positive, returns 1 if decremented.
+	decrScript = redis.NewScript(`
+for _, offset in ipairs(ARGV) do
+	if redis.call("bitfield", KEYS[1], "get", "u4", "#" .. offset)[1] == 0 then
+		return 0
+	end
+end
+for _, offset in ipairs(ARGV) do
+	local pos = "#" .. offset
+	local count = redis.call("bitfield", KEYS[1], "get", "u4", pos)[1]
+	if count > 0 and count < 15 then
+		redis.call("bitfield", KEYS[1], "set", "u4", pos, count - 1)
+	end
+end
+return 1
+`)
+	testCountScript = redis.NewScript(`
+for _, offset in ipairs(ARGV) do
+	if redis.call("bitfield", KEYS[1], "get", "u4", "#" .. offset)[1] == 0 then
+		return 0
+	end
+end
+return 1
+`)
+)
+
+type (
+	// A CountingFilter is a counting bloom filter, which supports removing items.
+	// Each location is a 4-bit counter instead of a bit, so it takes 4 times the memory
+	// of a Filter with the same number of locations.
+	CountingFilter struct {
+		counters uint
+		maps     uint
+		version  HashVersion
+		store    counterProvider
+	}
+
+	counterProvider interface {
+		check(ctx context.Context, offsets []uint) (bool, error)
+		incr(ctx context.Context, offsets []uint) error
+		decr(ctx context.Context, offsets []uint) (bool, error)
+	}
+)
+
+// NewCounting creates a redis backed CountingFilter, store is the backed redis,
+// key is the key for the filter, counters is how many 4-bit counters will be used.
+// Counting filters are new, so they always use HashV2.
+func NewCounting(store *redis.Client, key string, counters uint) *CountingFilter {
+	return newRedisCountingFilter(store, key, counters, maps, HashV2)
+}
+
+// NewCountingWithEstimates creates a redis backed CountingFilter sized for n elements
+// with false positive rate p, the parameters are stored in redis like NewWithEstimates.
+func NewCountingWithEstimates(store *redis.Client, key string, n uint, p float64) (*CountingFilter, error) {
+	return NewCountingWithEstimatesCtx(context.Background(), store, key, n, p)
+}
+
+// NewCountingWithEstimatesCtx is NewCountingWithEstimates with context.
+func NewCountingWithEstimatesCtx(ctx context.Context, store *redis.Client, key string, n uint,
+	p float64) (*CountingFilter, error) {
+	counters, maps, err := EstimateParameters(n, p)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := initMeta(ctx, store, key, counters, maps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRedisCountingFilter(store, key, counters, maps, version), nil
+}
+
+// NewLocalCounting creates a CountingFilter backed by in-process counters,
+// counters is how many 4-bit counters will be used.
+func NewLocalCounting(counters uint) *CountingFilter {
+	return newLocalCountingFilter(counters, maps)
+}
+
+// NewLocalCountingWithEstimates creates an in-process CountingFilter sized for n elements
+// with false positive rate p.
+func NewLocalCountingWithEstimates(n uint, p float64) (*CountingFilter, error) {
+	counters, maps, err := EstimateParameters(n, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLocalCountingFilter(counters, maps), nil
+}
+
+func newRedisCountingFilter(store *redis.Client, key string, counters, maps uint,
+	version HashVersion) *CountingFilter {
+	return &CountingFilter{
+		counters: counters,
+		maps:     maps,
+		version:  version,
+		store:    newRedisCounters(store, key, counters),
+	}
+}
+
+func newLocalCountingFilter(counters, maps uint) *CountingFilter {
+	return &CountingFilter{
+		counters: counters,
+		maps:     maps,
+		version:  HashV2,
+		store:    newLocalCounters(counters),
+	}
+}
+
+// Add adds data into f.
+func (f *CountingFilter) Add(data []byte) error {
+	return f.AddCtx(context.Background(), data)
+}
+
+// AddCtx adds data into f with context.
+func (f *CountingFilter) AddCtx(ctx context.Context, data []byte) error {
+	return f.store.incr(ctx, f.getLocations(data))
+}
+
+// Remove removes data from f, it returns false if data is not in f.
+// Only remove data that has been added, removing others may remove
+// items sharing the same counters.
+func (f *CountingFilter) Remove(data []byte) (bool, error) {
+	return f.RemoveCtx(context.Background(), data)
+}
+
+// RemoveCtx removes data from f with context.
+func (f *CountingFilter) RemoveCtx(ctx context.Context, data []byte) (bool, error) {
+	return f.store.decr(ctx, f.getLocations(data))
+}
+
+// Exists checks if data is in f.
+func (f *CountingFilter) Exists(data []byte) (bool, error) {
+	return f.ExistsCtx(context.Background(), data)
+}
+
+// ExistsCtx checks if data is in f with context.
+func (f *CountingFilter) ExistsCtx(ctx context.Context, data []byte) (bool, error) {
+	return f.store.check(ctx, f.getLocations(data))
+}
+
+func (f *CountingFilter) getLocations(data []byte) []uint {
+	locations := make([]uint, f.maps)
+	if f.version == HashV1 {
+		locationsV1(locations, data, f.counters)
+	} else {
+		locationsV2(locations, data, f.counters)
+	}
+
+	return locations
+}
+
+type redisCounters struct {
+	store    *redis.Client
+	key      string
+	counters uint
+}
+
+func newRedisCounters(store *redis.Client, key string, counters uint) *redisCounters {
+	return &redisCounters{
+		store:    store,
+		key:      key,
+		counters: counters,
+	}
+}
+
+func (r *redisCounters) buildOffsetArgs(offsets []uint) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(offsets))
+	for _, offset := range offsets {
+		if offset >= r.counters {
+			return nil, ErrTooLargeOffset
+		}
+
+		args = append(args, strconv.FormatUint(uint64(offset), 10))
+	}
+
+	return args, nil
+}
+
+func (r *redisCounters) check(ctx context.Context, offsets []uint) (bool, error) {
+	return r.run(ctx, testCountScript, offsets)
+}
+
+func (r *redisCounters) incr(ctx context.Context, offsets []uint) error {
+	args, err := r.buildOffsetArgs(offsets)
+	if err != nil {
+		return err
+	}
+
+	err = incrScript.Run(ctx, r.store, []string{r.key}, args...).Err()
+	if err == redis.Nil {
+		return nil
+	}
+
+	return err
+}
+
+func (r *redisCounters) decr(ctx context.Context, offsets []uint) (bool, error) {
+	return r.run(ctx, decrScript, offsets)
+}
+
+func (r *redisCounters) run(ctx context.Context, script *redis.Script, offsets []uint) (bool, error) {
+	args, err := r.buildOffsetArgs(offsets)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := script.Run(ctx, r.store, []string{r.key}, args...).Int64()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return resp == 1, nil
+}
+
+// localCounters packs 16 4-bit counters into each word.
+// A mutex is used because Remove must check and decrement all counters atomically.
+type localCounters struct {
+	lock     sync.RWMutex
+	counters uint
+	words    []uint64
+}
+
+func newLocalCounters(counters uint) *localCounters {
+	return &localCounters{
+		counters: counters,
+		words:    make([]uint64, (counters+15)/16),
+	}
+}
+
+func (l *localCounters) get(offset uint) uint64 {
+	return l.words[offset>>4] >> ((offset & 15) << 2) & maxCount
+}
+
+func (l *localCounters) add(offset uint, delta int) {
+	shift := (offset & 15) << 2
+	count := uint64(int64(l.get(offset)) + int64(delta))
+	l.words[offset>>4] = l.words[offset>>4]&^(maxCount<<shift) | count<<shift
+}
+
+func (l *localCounters) validate(offsets []uint) error {
+	for _, offset := range offsets {
+		if offset >= l.counters {
+			return ErrTooLargeOffset
+		}
+	}
+
+	return nil
+}
+
+func (l *localCounters) check(_ context.Context, offsets []uint) (bool, error) {
+	if err := l.validate(offsets); err != nil {
+		return false, err
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.allPositive(offsets), nil
+}
+
+func (l *localCounters) incr(_ context.Context, offsets []uint) error {
+	if err := l.validate(offsets); err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, offset := range offsets {
+		if l.get(offset) < maxCount {
+			l.add(offset, 1)
+		}
+	}
+
+	return nil
+}
+
+func (l *localCounters) decr(_ context.Context, offsets []uint) (bool, error) {
+	if err := l.validate(offsets); err != nil {
+		return false, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.allPositive(offsets) {
+		return false, nil
+	}
+
+	for _, offset := range offsets {
+		if count := l.get(offset); count > 0 && count < maxCount {
+			l.add(offset, -1)
+		}
+	}
+
+	return true, nil
+}
+
+func (l *localCounters) allPositive(offsets []uint) bool {
+	for _, offset := range offsets {
+		if l.get(offset) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
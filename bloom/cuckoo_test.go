@@ -0,0 +1,102 @@
+package bloom
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var cuckooTestBuckets = []uint{1, 2, 3, 7, 64, 1000, 1<<20 + 7, math.MaxUint32}
+
+// alt in cuckooHelpers: (fp * mul - b) % n
+var luaAltPattern = regexp.MustCompile(`return \(fp \* (\d+) - b\) % n`)
+
+func bucketIndexes(buckets uint) []uint {
+	var indexes []uint
+	for _, i := range []uint{0, 1, buckets / 2, buckets - 1} {
+		if i < buckets {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func TestAltBucketInverse(t *testing.T) {
+	for _, buckets := range cuckooTestBuckets {
+		for fp := 1; fp <= math.MaxUint16; fp += 97 {
+			for _, i := range bucketIndexes(buckets) {
+				alt := altBucket(i, uint16(fp), buckets)
+				if alt >= buckets {
+					t.Fatalf("altBucket(%d, %d, %d) = %d out of range", i, fp, buckets, alt)
+				}
+				if back := altBucket(alt, uint16(fp), buckets); back != i {
+					t.Fatalf("altBucket(altBucket(%d, %d, %d)) = %d", i, fp, buckets, back)
+				}
+			}
+		}
+	}
+}
+
+// luaAlt computes alt of cuckooHelpers with lua numbers, which are float64,
+// a % b is a - floor(a/b)*b in lua.
+func luaAlt(mul float64, b uint, fp uint16, buckets uint) uint {
+	a := float64(fp)*mul - float64(b)
+	n := float64(buckets)
+	return uint(a - math.Floor(a/n)*n)
+}
+
+func TestAltBucketMatchesLua(t *testing.T) {
+	match := luaAltPattern.FindStringSubmatch(cuckooHelpers)
+	if match == nil {
+		t.Fatal("alt not found in cuckooHelpers")
+	}
+	mul, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mul != fingerprintMul {
+		t.Fatalf("lua multiplier %d, want %d", mul, fingerprintMul)
+	}
+
+	for _, buckets := range cuckooTestBuckets {
+		for fp := 1; fp <= math.MaxUint16; fp += 97 {
+			for _, i := range bucketIndexes(buckets) {
+				want := altBucket(i, uint16(fp), buckets)
+				if got := luaAlt(float64(mul), i, uint16(fp), buckets); got != want {
+					t.Fatalf("lua alt(%d, %d) mod %d = %d, want %d", i, fp, buckets, got, want)
+				}
+			}
+		}
+	}
+}
+
+// a failed add reverts its kicks, so the added items are still found
+func TestLocalCuckooFull(t *testing.T) {
+	f := NewLocalCuckoo(200)
+	var added [][]byte
+	for i := 0; ; i++ {
+		data := []byte("item" + strconv.Itoa(i))
+		err := f.Add(data)
+		if err == ErrCuckooFull {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		added = append(added, data)
+	}
+
+	count, err := f.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != uint64(len(added)) {
+		t.Fatalf("count = %d, want %d", count, len(added))
+	}
+	for _, data := range added {
+		if ok, err := f.Exists(data); err != nil || !ok {
+			t.Fatalf("%s lost after a failed add", data)
+		}
+	}
+}
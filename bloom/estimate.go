@@ -0,0 +1,166 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	metaSuffix       = ":meta"
+	metaBitsField    = "bits"
+	metaMapsField    = "maps"
+	metaVersionField = "version"
+)
+
+var (
+	// ErrInvalidEstimates indicates the expected elements or false positive rate is invalid.
+	ErrInvalidEstimates = errors.New("invalid bloom estimates")
+	// ErrMetaNotFound indicates the filter has no parameters stored in redis.
+	ErrMetaNotFound = errors.New("bloom meta not found")
+	// ErrParamsMismatch indicates the parameters stored in redis differ from the requested ones.
+	ErrParamsMismatch = errors.New("bloom params mismatch")
+	// ErrInvalidMeta indicates the parameters stored in redis are invalid.
+	ErrInvalidMeta = errors.New("invalid bloom meta")
+
+	// initMetaScript stores the parameters if absent and returns the stored ones.
+	initMetaScript = redis.NewScript(`
+if redis.call("exists", KEYS[1]) == 0 then
+	redis.call("hset", KEYS[1], "bits", ARGV[1], "maps", ARGV[2], "version", ARGV[3])
+end
+return redis.call("hmget", KEYS[1], "bits", "maps", "version")
+`)
+)
+
+// EstimateParameters returns the optimal bits and maps for n elements
+// with false positive rate p:
+// bits = -n*ln(p)/(ln2)^2, maps = bits/n*ln2.
+func EstimateParameters(n uint, p float64) (bits, maps uint, err error) {
+	if n == 0 || p <= 0 || p >= 1 {
+		return 0, 0, ErrInvalidEstimates
+	}
+
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+
+	return uint(m), uint(k), nil
+}
+
+// NewWithEstimates creates a redis backed Filter sized for n elements with
+// false positive rate p. The parameters are stored in redis next to key,
+// so that other processes opening the same filter use consistent parameters,
+// ErrParamsMismatch is returned if the stored parameters differ.
+// New filters use HashV2, an existing filter keeps its stored hash version.
+func NewWithEstimates(store *redis.Client, key string, n uint, p float64) (*Filter, error) {
+	return NewWithEstimatesCtx(context.Background(), store, key, n, p)
+}
+
+// NewWithEstimatesCtx is NewWithEstimates with context.
+func NewWithEstimatesCtx(ctx context.Context, store *redis.Client, key string, n uint, p float64) (*Filter, error) {
+	bits, maps, err := EstimateParameters(n, p)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := initMeta(ctx, store, key, bits, maps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRedisFilter(store, key, bits, maps, version), nil
+}
+
+// initMeta stores the parameters with HashV2 if absent, and returns the stored hash version.
+func initMeta(ctx context.Context, store *redis.Client, key string, bits, maps uint) (HashVersion, error) {
+	resp, err := initMetaScript.Run(ctx, store, []string{metaKey(key)},
+		strconv.FormatUint(uint64(bits), 10), strconv.FormatUint(uint64(maps), 10),
+		strconv.Itoa(int(HashV2))).Result()
+	if err != nil {
+		return 0, err
+	}
+	storedBits, storedMaps, version, err := parseMeta(resp)
+	if err != nil {
+		return 0, err
+	}
+	if storedBits != bits || storedMaps != maps {
+		return 0, fmt.Errorf("%w: stored bits=%d maps=%d, requested bits=%d maps=%d",
+			ErrParamsMismatch, storedBits, storedMaps, bits, maps)
+	}
+
+	return version, nil
+}
+
+// Open opens an existing redis backed Filter with the parameters stored in redis.
+func Open(store *redis.Client, key string) (*Filter, error) {
+	return OpenCtx(context.Background(), store, key)
+}
+
+// OpenCtx is Open with context.
+func OpenCtx(ctx context.Context, store *redis.Client, key string) (*Filter, error) {
+	resp, err := store.HMGet(ctx, metaKey(key), metaBitsField, metaMapsField, metaVersionField).Result()
+	if err != nil {
+		return nil, err
+	}
+	bits, maps, version, err := parseMeta(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRedisFilter(store, key, bits, maps, version), nil
+}
+
+// NewLocalWithEstimates creates an in-process Filter sized for n elements
+// with false positive rate p.
+func NewLocalWithEstimates(n uint, p float64) (*Filter, error) {
+	bits, maps, err := EstimateParameters(n, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLocalFilter(bits, maps, HashV2), nil
+}
+
+func metaKey(key string) string {
+	return key + metaSuffix
+}
+
+// parseMeta parses bits, maps and version, a missing version means HashV1.
+func parseMeta(resp interface{}) (bits, maps uint, version HashVersion, err error) {
+	fields, ok := resp.([]interface{})
+	if !ok || len(fields) < 2 || fields[0] == nil || fields[1] == nil {
+		return 0, 0, 0, ErrMetaNotFound
+	}
+
+	values := []uint64{0, 0, uint64(HashV1)}
+	for i, field := range fields {
+		if field == nil {
+			continue
+		}
+		s, ok := field.(string)
+		if !ok {
+			return 0, 0, 0, ErrMetaNotFound
+		}
+		if values[i], err = strconv.ParseUint(s, 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	if !validParams(values[0], values[1], HashVersion(values[2])) {
+		return 0, 0, 0, ErrInvalidMeta
+	}
+
+	return uint(values[0]), uint(values[1]), HashVersion(values[2]), nil
+}
+
+// validParams checks the parameters read from redis or a snapshot before they are used.
+func validParams(bits, maps uint64, version HashVersion) bool {
+	return bits > 0 && bits <= MaxSnapshotBits && maps > 0 && maps <= maxSnapshotMaps &&
+		(version == HashV1 || version == HashV2)
+}
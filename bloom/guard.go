@@ -0,0 +1,251 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultGuardTTL is how long loaded values are cached by default.
+	DefaultGuardTTL = time.Hour
+	// DefaultGuardNotFoundTTL is how long not found results are cached by default.
+	DefaultGuardNotFoundTTL = time.Minute
+	// DefaultGuardJitter is the default fraction of TTLs added at random.
+	DefaultGuardJitter = 0.1
+
+	// cached values are prefixed to tell not found results from empty values.
+	cachedValue    = 'v'
+	cachedNotFound = '-'
+	sweepInterval  = time.Minute
+)
+
+// ErrNotFound indicates the key doesn't exist, returned by Guard.Get and loaders.
+var ErrNotFound = errors.New("not found")
+
+type (
+	// Membership is implemented by Filter, CountingFilter, ScalableFilter,
+	// RotatingFilter and CuckooFilter.
+	Membership interface {
+		ExistsCtx(ctx context.Context, data []byte) (bool, error)
+	}
+
+	// Cache stores the values of a Guard.
+	Cache interface {
+		Get(ctx context.Context, key string) ([]byte, bool, error)
+		Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	}
+
+	// LoaderFunc loads the value of key from the source, like mysql,
+	// it returns ErrNotFound if key doesn't exist.
+	LoaderFunc func(ctx context.Context, key string) ([]byte, error)
+
+	// A Guard protects the source from cache penetration:
+	// keys not in the filter are not found without touching the cache or the source,
+	// not found results are cached for NotFoundTTL, and concurrent misses of the same key
+	// are loaded once. Keys must be added into the filter when they are created.
+	Guard struct {
+		filter Membership
+		cache  Cache
+		load   LoaderFunc
+		flight flightGroup
+		// TTL is how long loaded values are cached, DefaultGuardTTL by default.
+		TTL time.Duration
+		// NotFoundTTL is how long not found results are cached, DefaultGuardNotFoundTTL by default.
+		NotFoundTTL time.Duration
+		// Jitter adds a random fraction up to Jitter to TTLs, so that keys cached together
+		// don't expire together, DefaultGuardJitter by default.
+		Jitter float64
+	}
+)
+
+// NewGuard returns a Guard that checks filter, then cache, then load.
+func NewGuard(filter Membership, cache Cache, load LoaderFunc) *Guard {
+	return &Guard{
+		filter:      filter,
+		cache:       cache,
+		load:        load,
+		TTL:         DefaultGuardTTL,
+		NotFoundTTL: DefaultGuardNotFoundTTL,
+		Jitter:      DefaultGuardJitter,
+	}
+}
+
+// Get returns the value of key, ErrNotFound is returned if key doesn't exist.
+// If the filter or the cache fails, Get falls back to the next step,
+// so that the source is still reachable.
+func (g *Guard) Get(ctx context.Context, key string) ([]byte, error) {
+	exists, err := g.filter.ExistsCtx(ctx, []byte(key))
+	if err == nil && !exists {
+		return nil, ErrNotFound
+	}
+
+	if cached, ok, err := g.cache.Get(ctx, key); err == nil && ok {
+		return decodeCached(cached)
+	}
+
+	// concurrent misses share the load of the first caller, and its context
+	return g.flight.do(key, func() ([]byte, error) {
+		value, err := g.load(ctx, key)
+		switch {
+		case err == nil:
+			g.cache.Set(ctx, key, append([]byte{cachedValue}, value...), g.jitter(g.TTL))
+		case errors.Is(err, ErrNotFound):
+			g.cache.Set(ctx, key, []byte{cachedNotFound}, g.jitter(g.NotFoundTTL))
+			return nil, ErrNotFound
+		}
+
+		return value, err
+	})
+}
+
+func (g *Guard) jitter(ttl time.Duration) time.Duration {
+	if g.Jitter <= 0 {
+		return ttl
+	}
+
+	return ttl + time.Duration(rand.Float64()*g.Jitter*float64(ttl))
+}
+
+func decodeCached(cached []byte) ([]byte, error) {
+	if len(cached) == 0 || cached[0] != cachedValue {
+		return nil, ErrNotFound
+	}
+
+	return cached[1:], nil
+}
+
+type (
+	flightGroup struct {
+		lock  sync.Mutex
+		calls map[string]*flightCall
+	}
+
+	flightCall struct {
+		wg    sync.WaitGroup
+		value []byte
+		err   error
+	}
+)
+
+// do calls fn once for concurrent calls with the same key, all of them get its result.
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.lock.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.lock.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+
+	call := new(flightCall)
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.lock.Unlock()
+
+	defer func() {
+		g.lock.Lock()
+		delete(g.calls, key)
+		g.lock.Unlock()
+		call.wg.Done()
+	}()
+	call.value, call.err = fn()
+
+	return call.value, call.err
+}
+
+// RedisCache is a Cache in redis.
+type RedisCache struct {
+	store  *redis.Client
+	prefix string
+}
+
+// NewRedisCache returns a RedisCache, prefix is put before the keys.
+func NewRedisCache(store *redis.Client, prefix string) *RedisCache {
+	return &RedisCache{
+		store:  store,
+		prefix: prefix,
+	}
+}
+
+// Get returns the value of key, false if not cached.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.store.Get(ctx, c.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set caches value of key for ttl.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.store.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+type (
+	// LocalCache is an in-process Cache, expired keys are removed every minute.
+	LocalCache struct {
+		lock      sync.Mutex
+		entries   map[string]localEntry
+		nextSweep time.Time
+		nowFunc   func() time.Time
+	}
+
+	localEntry struct {
+		value    []byte
+		expireAt time.Time
+	}
+)
+
+// NewLocalCache returns a LocalCache.
+func NewLocalCache() *LocalCache {
+	return &LocalCache{
+		entries: make(map[string]localEntry),
+		nowFunc: time.Now,
+	}
+}
+
+// Get returns the value of key, false if not cached.
+func (c *LocalCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !c.nowFunc().Before(entry.expireAt) {
+		return nil, false, nil
+	}
+
+	return entry.value, true, nil
+}
+
+// Set caches value of key for ttl.
+func (c *LocalCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.nowFunc()
+	if now.After(c.nextSweep) {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expireAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(sweepInterval)
+	}
+
+	c.entries[key] = localEntry{
+		value:    value,
+		expireAt: now.Add(ttl),
+	}
+
+	return nil
+}
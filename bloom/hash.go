@@ -0,0 +1,34 @@
+package bloom
+
+import "github.com/spaolacci/murmur3"
+
+// HashVersion identifies how the locations of data are computed.
+// It is stored with the filter parameters, a filter must keep its version once created.
+type HashVersion uint8
+
+const (
+	// HashV1 computes each location with a separate murmur3 of data plus the location index,
+	// used by filters created with New.
+	HashV1 HashVersion = iota + 1
+	// HashV2 derives all locations from the two 64-bit halves of one 128-bit murmur3
+	// with Kirsch–Mitzenmacher double hashing: location(i) = (h1 + i*h2) % bits.
+	HashV2
+)
+
+// locationsV1 keeps the layout of Hash(append(data, byte(i))) without writing
+// into the backing array of data.
+func locationsV1(locations []uint, data []byte, bits uint) {
+	buf := make([]byte, len(data)+1)
+	copy(buf, data)
+	for i := range locations {
+		buf[len(data)] = byte(i)
+		locations[i] = uint(Hash(buf) % uint64(bits))
+	}
+}
+
+func locationsV2(locations []uint, data []byte, bits uint) {
+	h1, h2 := murmur3.Sum128(data)
+	for i := range locations {
+		locations[i] = uint((h1 + uint64(i)*h2) % uint64(bits))
+	}
+}
@@ -0,0 +1,45 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+const benchElements = 1000000
+
+func BenchmarkLocationsV1(b *testing.B) {
+	benchmarkLocations(b, HashV1, locationsV1)
+}
+
+func BenchmarkLocationsV2(b *testing.B) {
+	benchmarkLocations(b, HashV2, locationsV2)
+}
+
+func benchmarkLocations(b *testing.B, version HashVersion, locations func([]uint, []byte, uint)) {
+	data := make([][]byte, benchElements)
+	for i := range data {
+		data[i] = []byte("user:" + strconv.Itoa(i))
+	}
+
+	b.Run("Locations", func(b *testing.B) {
+		b.ReportAllocs()
+		locs := make([]uint, maps)
+		for i := 0; i < b.N; i++ {
+			locations(locs, data[i%benchElements], 20*benchElements)
+		}
+	})
+
+	f := NewLocalWithHashVersion(20*benchElements, version)
+	b.Run("Add", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = f.Add(data[i%benchElements])
+		}
+	})
+	b.Run("Exists", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = f.Exists(data[i%benchElements])
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package bloom
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// A LocalBitSet is an in-process bitset, safe for concurrent use without locks.
+type LocalBitSet struct {
+	bits  uint
+	words []uint64
+}
+
+// NewLocalBitSet returns a LocalBitSet with the given number of bits.
+func NewLocalBitSet(bits uint) *LocalBitSet {
+	return &LocalBitSet{
+		bits:  bits,
+		words: make([]uint64, (bits+63)/64),
+	}
+}
+
+// NewLocal creates a Filter backed by an in-process bitset,
+// bits is how many bits will be used.
+// The filter is not shared across processes, see New for the redis backed one.
+func NewLocal(bits uint) *Filter {
+	return newLocalFilter(bits, maps, HashV2)
+}
+
+// NewLocalWithHashVersion is like NewLocal but computes locations with the given hash version.
+func NewLocalWithHashVersion(bits uint, version HashVersion) *Filter {
+	return newLocalFilter(bits, maps, version)
+}
+
+func newLocalFilter(bits, maps uint, version HashVersion) *Filter {
+	return &Filter{
+		bits:    bits,
+		maps:    maps,
+		version: version,
+		bitSet:  NewLocalBitSet(bits),
+	}
+}
+
+func (l *LocalBitSet) check(_ context.Context, offsets []uint) (bool, error) {
+	for _, offset := range offsets {
+		if offset >= l.bits {
+			return false, ErrTooLargeOffset
+		}
+	}
+
+	for _, offset := range offsets {
+		if atomic.LoadUint64(&l.words[offset>>6])&(1<<(offset&63)) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (l *LocalBitSet) set(_ context.Context, offsets []uint) error {
+	for _, offset := range offsets {
+		if offset >= l.bits {
+			return ErrTooLargeOffset
+		}
+	}
+
+	for _, offset := range offsets {
+		addr := &l.words[offset>>6]
+		mask := uint64(1) << (offset & 63)
+		for {
+			old := atomic.LoadUint64(addr)
+			if old&mask != 0 || atomic.CompareAndSwapUint64(addr, old, old|mask) {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *LocalBitSet) checkMany(ctx context.Context, offsets [][]uint) ([]bool, error) {
+	result := make([]bool, len(offsets))
+	for i, item := range offsets {
+		exists, err := l.check(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = exists
+	}
+
+	return result, nil
+}
+
+func (l *LocalBitSet) setMany(ctx context.Context, offsets [][]uint) error {
+	for _, item := range offsets {
+		if err := l.set(ctx, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
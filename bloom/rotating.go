@@ -0,0 +1,248 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidRotation indicates the bits, generations or period of a RotatingFilter is invalid.
+var ErrInvalidRotation = errors.New("invalid bloom rotation")
+
+var (
+	// KEYS[1] is the current generation, ARGV[1] is when it expires in unix milliseconds.
+	rotatingSetScript = redis.NewScript(`
+for i = 2, #ARGV do
+	redis.call("setbit", KEYS[1], ARGV[i], 1)
+end
+redis.call("pexpireat", KEYS[1], ARGV[1])
+`)
+	// KEYS are the live generations, returns 1 if any of them has all offsets set.
+	rotatingTestScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	local exists = 1
+	for _, offset in ipairs(ARGV) do
+		if redis.call("getbit", key, offset) == 0 then
+			exists = 0
+			break
+		end
+	end
+	if exists == 1 then
+		return 1
+	end
+end
+return 0
+`)
+)
+
+type (
+	// A RotatingFilter is a bloom filter that forgets items over time.
+	// Items are added into the current generation, and checked against all live generations,
+	// a generation lives for generations*period, so an added item is visible for
+	// at least (generations-1)*period and at most generations*period.
+	RotatingFilter struct {
+		bits        uint
+		maps        uint
+		generations int
+		period      time.Duration
+		nowFunc     func() time.Time
+		store       rotatingProvider
+	}
+
+	rotatingProvider interface {
+		check(ctx context.Context, gen int64, offsets []uint) (bool, error)
+		set(ctx context.Context, gen int64, offsets []uint) error
+	}
+)
+
+// NewRotating creates a redis backed RotatingFilter, key is the prefix of the generation keys,
+// bits is how many bits each generation uses, generations is how many generations are live,
+// period is how long each generation takes writes, like 24 generations of an hour.
+// Old generations are removed by redis TTLs.
+func NewRotating(store *redis.Client, key string, bits uint, generations int,
+	period time.Duration) (*RotatingFilter, error) {
+	if err := checkRotation(bits, generations, period); err != nil {
+		return nil, err
+	}
+
+	return newRotatingFilter(bits, generations, period, &redisRotating{
+		store:       store,
+		key:         key,
+		bits:        bits,
+		generations: generations,
+		period:      period,
+	}), nil
+}
+
+// NewLocalRotating creates an in-process RotatingFilter, see NewRotating for the parameters.
+func NewLocalRotating(bits uint, generations int, period time.Duration) (*RotatingFilter, error) {
+	if err := checkRotation(bits, generations, period); err != nil {
+		return nil, err
+	}
+
+	return newRotatingFilter(bits, generations, period, &localRotating{
+		bits:  bits,
+		slots: make([]localGeneration, generations),
+	}), nil
+}
+
+func checkRotation(bits uint, generations int, period time.Duration) error {
+	if bits == 0 || generations < 1 || period <= 0 {
+		return ErrInvalidRotation
+	}
+
+	return nil
+}
+
+func newRotatingFilter(bits uint, generations int, period time.Duration, store rotatingProvider) *RotatingFilter {
+	return &RotatingFilter{
+		bits:        bits,
+		maps:        maps,
+		generations: generations,
+		period:      period,
+		nowFunc:     time.Now,
+		store:       store,
+	}
+}
+
+// Add adds data into the current generation of f.
+func (f *RotatingFilter) Add(data []byte) error {
+	return f.AddCtx(context.Background(), data)
+}
+
+// AddCtx adds data into the current generation of f with context.
+func (f *RotatingFilter) AddCtx(ctx context.Context, data []byte) error {
+	return f.store.set(ctx, f.generation(), f.getLocations(data))
+}
+
+// Exists checks if data is in any live generation of f.
+func (f *RotatingFilter) Exists(data []byte) (bool, error) {
+	return f.ExistsCtx(context.Background(), data)
+}
+
+// ExistsCtx checks if data is in any live generation of f with context.
+func (f *RotatingFilter) ExistsCtx(ctx context.Context, data []byte) (bool, error) {
+	return f.store.check(ctx, f.generation(), f.getLocations(data))
+}
+
+func (f *RotatingFilter) generation() int64 {
+	return f.nowFunc().UnixNano() / int64(f.period)
+}
+
+func (f *RotatingFilter) getLocations(data []byte) []uint {
+	locations := make([]uint, f.maps)
+	locationsV2(locations, data, f.bits)
+	return locations
+}
+
+type redisRotating struct {
+	store       *redis.Client
+	key         string
+	bits        uint
+	generations int
+	period      time.Duration
+}
+
+func (r *redisRotating) buildOffsetArgs(offsets []uint) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(offsets)+1)
+	for _, offset := range offsets {
+		if offset >= r.bits {
+			return nil, ErrTooLargeOffset
+		}
+
+		args = append(args, strconv.FormatUint(uint64(offset), 10))
+	}
+
+	return args, nil
+}
+
+func (r *redisRotating) check(ctx context.Context, gen int64, offsets []uint) (bool, error) {
+	args, err := r.buildOffsetArgs(offsets)
+	if err != nil {
+		return false, err
+	}
+
+	keys := make([]string, r.generations)
+	for i := range keys {
+		keys[i] = r.generationKey(gen - int64(i))
+	}
+
+	resp, err := rotatingTestScript.Run(ctx, r.store, keys, args...).Int64()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return resp == 1, nil
+}
+
+func (r *redisRotating) set(ctx context.Context, gen int64, offsets []uint) error {
+	args, err := r.buildOffsetArgs(offsets)
+	if err != nil {
+		return err
+	}
+
+	expireAt := time.Duration(gen+int64(r.generations)) * r.period / time.Millisecond
+	args = append([]interface{}{strconv.FormatInt(int64(expireAt), 10)}, args...)
+	err = rotatingSetScript.Run(ctx, r.store, []string{r.generationKey(gen)}, args...).Err()
+	if err == redis.Nil {
+		return nil
+	}
+
+	return err
+}
+
+func (r *redisRotating) generationKey(gen int64) string {
+	return r.key + ":" + strconv.FormatInt(gen, 10)
+}
+
+type (
+	localRotating struct {
+		lock  sync.Mutex
+		bits  uint
+		slots []localGeneration
+	}
+
+	localGeneration struct {
+		gen    int64
+		bitSet *LocalBitSet
+	}
+)
+
+func (l *localRotating) check(ctx context.Context, gen int64, offsets []uint) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	live := int64(len(l.slots))
+	for _, slot := range l.slots {
+		if slot.bitSet == nil || slot.gen <= gen-live || slot.gen > gen {
+			continue
+		}
+
+		exists, err := slot.bitSet.check(ctx, offsets)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return false, nil
+}
+
+func (l *localRotating) set(ctx context.Context, gen int64, offsets []uint) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// the slot of an expired generation is reused by the current one
+	slot := &l.slots[int(gen%int64(len(l.slots)))]
+	if slot.bitSet == nil || slot.gen != gen {
+		slot.gen = gen
+		slot.bitSet = NewLocalBitSet(l.bits)
+	}
+
+	return slot.bitSet.set(ctx, offsets)
+}
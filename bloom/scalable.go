@@ -0,0 +1,372 @@
+package bloom
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A scalable bloom filter, see "Scalable Bloom Filters" by Almeida et al.
+// Layer i holds capacity*growth^i items with false positive rate p0*tightening^i,
+// p0 = p*(1-tightening), so the compound false positive rate stays under p.
+const (
+	scalableGrowth     = 2
+	scalableTightening = 0.8
+
+	stateSuffix      = ":state"
+	stateCapacity    = "capacity"
+	stateErrorRate   = "error"
+	stateLayers      = "layers"
+	stateCount       = "count"
+	stateLayerPrefix = "count:"
+)
+
+var (
+	initStateScript = redis.NewScript(`
+redis.call("hsetnx", KEYS[1], "capacity", ARGV[1])
+redis.call("hsetnx", KEYS[1], "error", ARGV[2])
+redis.call("hsetnx", KEYS[1], "layers", 1)
+return redis.call("hmget", KEYS[1], "capacity", "error", "layers")
+`)
+	// KEYS[1] is the state, KEYS[i+1] is the bitset of layer i.
+	// ARGV[1] is how many layers are provided, followed by capacity, maps and offsets of each layer.
+	// Both scripts return {result, layers}, result -1 means more layers are needed.
+	scalableAddScript = redis.NewScript(`
+local layers = tonumber(redis.call("hget", KEYS[1], "layers") or "1")
+local provided = tonumber(ARGV[1])
+if layers > provided then
+	return {-1, layers}
+end
+local groups = {}
+local i = 2
+for layer = 1, provided do
+	local maps = tonumber(ARGV[i + 1])
+	groups[layer] = {tonumber(ARGV[i]), i + 2, i + 1 + maps}
+	i = i + 2 + maps
+end
+for layer = 1, layers do
+	local exists = true
+	for j = groups[layer][2], groups[layer][3] do
+		if redis.call("getbit", KEYS[layer + 1], ARGV[j]) == 0 then
+			exists = false
+			break
+		end
+	end
+	if exists then
+		return {0, layers}
+	end
+end
+local count = tonumber(redis.call("hget", KEYS[1], "count:" .. (layers - 1)) or "0")
+if count >= groups[layers][1] then
+	if layers == provided then
+		return {-1, layers + 1}
+	end
+	layers = layers + 1
+	redis.call("hset", KEYS[1], "layers", layers)
+end
+for j = groups[layers][2], groups[layers][3] do
+	redis.call("setbit", KEYS[layers + 1], ARGV[j], 1)
+end
+redis.call("hincrby", KEYS[1], "count:" .. (layers - 1), 1)
+redis.call("hincrby", KEYS[1], "count", 1)
+return {1, layers}
+`)
+	scalableTestScript = redis.NewScript(`
+local layers = tonumber(redis.call("hget", KEYS[1], "layers") or "1")
+local provided = tonumber(ARGV[1])
+if layers > provided then
+	return {-1, layers}
+end
+local i = 2
+for layer = 1, layers do
+	local maps = tonumber(ARGV[i + 1])
+	local exists = true
+	for j = i + 2, i + 1 + maps do
+		if redis.call("getbit", KEYS[layer + 1], ARGV[j]) == 0 then
+			exists = false
+			break
+		end
+	end
+	if exists then
+		return {1, layers}
+	end
+	i = i + 2 + maps
+end
+return {0, layers}
+`)
+)
+
+type (
+	// A ScalableFilter is a bloom filter that adds layers as items are added,
+	// so the false positive rate holds without knowing the number of items in advance.
+	ScalableFilter struct {
+		capacity uint
+		p        float64
+		layers   []scalableLayer
+		lock     sync.RWMutex
+		store    scalableProvider
+	}
+
+	scalableLayer struct {
+		capacity uint
+		bits     uint
+		maps     uint
+	}
+
+	scalableProvider interface {
+		add(ctx context.Context, f *ScalableFilter, data []byte) (bool, error)
+		check(ctx context.Context, f *ScalableFilter, data []byte) (bool, error)
+		count(ctx context.Context) (uint64, error)
+	}
+)
+
+// NewScalable creates a redis backed ScalableFilter, capacity is how many items
+// the first layer holds, p is the false positive rate of the whole filter.
+// The parameters are stored in redis, ErrParamsMismatch is returned if the stored ones differ.
+func NewScalable(store *redis.Client, key string, capacity uint, p float64) (*ScalableFilter, error) {
+	return NewScalableCtx(context.Background(), store, key, capacity, p)
+}
+
+// NewScalableCtx is NewScalable with context.
+func NewScalableCtx(ctx context.Context, store *redis.Client, key string, capacity uint,
+	p float64) (*ScalableFilter, error) {
+	f, err := newScalableFilter(capacity, p)
+	if err != nil {
+		return nil, err
+	}
+
+	capacityArg := strconv.FormatUint(uint64(capacity), 10)
+	errorArg := strconv.FormatFloat(p, 'g', -1, 64)
+	resp, err := initStateScript.Run(ctx, store, []string{key + stateSuffix}, capacityArg, errorArg).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 3 || resp[0] != capacityArg || resp[1] != errorArg {
+		return nil, fmt.Errorf("%w: stored capacity=%v error=%v, requested capacity=%s error=%s",
+			ErrParamsMismatch, resp[0], resp[1], capacityArg, errorArg)
+	}
+	layers, err := strconv.ParseUint(fmt.Sprint(resp[2]), 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	f.store = &redisScalable{
+		store:  store,
+		key:    key,
+		layers: uint32(layers),
+	}
+
+	return f, nil
+}
+
+// NewLocalScalable creates an in-process ScalableFilter, capacity is how many items
+// the first layer holds, p is the false positive rate of the whole filter.
+func NewLocalScalable(capacity uint, p float64) (*ScalableFilter, error) {
+	f, err := newScalableFilter(capacity, p)
+	if err != nil {
+		return nil, err
+	}
+
+	f.store = new(localScalable)
+	return f, nil
+}
+
+func newScalableFilter(capacity uint, p float64) (*ScalableFilter, error) {
+	if _, _, err := EstimateParameters(capacity, p*(1-scalableTightening)); err != nil {
+		return nil, err
+	}
+
+	return &ScalableFilter{
+		capacity: capacity,
+		p:        p,
+	}, nil
+}
+
+// Add adds data into f, it returns false if data is already in f.
+func (f *ScalableFilter) Add(data []byte) (bool, error) {
+	return f.AddCtx(context.Background(), data)
+}
+
+// AddCtx adds data into f with context.
+func (f *ScalableFilter) AddCtx(ctx context.Context, data []byte) (bool, error) {
+	return f.store.add(ctx, f, data)
+}
+
+// Exists checks if data is in f.
+func (f *ScalableFilter) Exists(data []byte) (bool, error) {
+	return f.ExistsCtx(context.Background(), data)
+}
+
+// ExistsCtx checks if data is in f with context.
+func (f *ScalableFilter) ExistsCtx(ctx context.Context, data []byte) (bool, error) {
+	return f.store.check(ctx, f, data)
+}
+
+// Count returns how many items have been added into f.
+func (f *ScalableFilter) Count() (uint64, error) {
+	return f.CountCtx(context.Background())
+}
+
+// CountCtx returns how many items have been added into f with context.
+func (f *ScalableFilter) CountCtx(ctx context.Context) (uint64, error) {
+	return f.store.count(ctx)
+}
+
+// layer returns the parameters of layer i.
+func (f *ScalableFilter) layer(i int) scalableLayer {
+	f.lock.RLock()
+	if i < len(f.layers) {
+		layer := f.layers[i]
+		f.lock.RUnlock()
+		return layer
+	}
+	f.lock.RUnlock()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.layers) <= i {
+		n := len(f.layers)
+		capacity := uint(float64(f.capacity) * math.Pow(scalableGrowth, float64(n)))
+		p := f.p * (1 - scalableTightening) * math.Pow(scalableTightening, float64(n))
+		// parameters are validated in newScalableFilter, and tighter p stays valid
+		bits, maps, _ := EstimateParameters(capacity, p)
+		f.layers = append(f.layers, scalableLayer{
+			capacity: capacity,
+			bits:     bits,
+			maps:     maps,
+		})
+	}
+
+	return f.layers[i]
+}
+
+func (f *ScalableFilter) locations(i int, data []byte) []uint {
+	layer := f.layer(i)
+	locations := make([]uint, layer.maps)
+	locationsV2(locations, data, layer.bits)
+	return locations
+}
+
+type redisScalable struct {
+	store *redis.Client
+	key   string
+	// layers caches the number of layers in redis, the scripts return the real one.
+	layers uint32
+}
+
+func (r *redisScalable) add(ctx context.Context, f *ScalableFilter, data []byte) (bool, error) {
+	// provide one more layer, so that the script can grow without another round trip.
+	return r.run(ctx, scalableAddScript, f, data, 1)
+}
+
+func (r *redisScalable) check(ctx context.Context, f *ScalableFilter, data []byte) (bool, error) {
+	return r.run(ctx, scalableTestScript, f, data, 0)
+}
+
+func (r *redisScalable) count(ctx context.Context) (uint64, error) {
+	count, err := r.store.HGet(ctx, r.key+stateSuffix, stateCount).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return count, err
+}
+
+func (r *redisScalable) run(ctx context.Context, script *redis.Script, f *ScalableFilter, data []byte,
+	extra int) (bool, error) {
+	for {
+		layers := int(atomic.LoadUint32(&r.layers)) + extra
+		keys := []string{r.key + stateSuffix}
+		args := []interface{}{strconv.Itoa(layers)}
+		for i := 0; i < layers; i++ {
+			locations := f.locations(i, data)
+			keys = append(keys, r.layerKey(i))
+			args = append(args, strconv.FormatUint(uint64(f.layer(i).capacity), 10), strconv.Itoa(len(locations)))
+			for _, location := range locations {
+				args = append(args, strconv.FormatUint(uint64(location), 10))
+			}
+		}
+
+		resp, err := script.Run(ctx, r.store, keys, args...).Int64Slice()
+		if err != nil {
+			return false, err
+		}
+		if len(resp) != 2 {
+			return false, fmt.Errorf("unexpected scalable bloom response: %v", resp)
+		}
+
+		atomic.StoreUint32(&r.layers, uint32(resp[1]))
+		if resp[0] >= 0 {
+			return resp[0] == 1, nil
+		}
+	}
+}
+
+func (r *redisScalable) layerKey(i int) string {
+	if i == 0 {
+		return r.key
+	}
+
+	return r.key + ":" + strconv.Itoa(i)
+}
+
+type localScalable struct {
+	lock   sync.RWMutex
+	layers []*LocalBitSet
+	counts []uint
+	total  uint64
+}
+
+func (l *localScalable) add(ctx context.Context, f *ScalableFilter, data []byte) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	exists, err := l.exists(ctx, f, data)
+	if err != nil || exists {
+		return false, err
+	}
+
+	last := len(l.layers) - 1
+	if last < 0 || l.counts[last] >= f.layer(last).capacity {
+		last++
+		l.layers = append(l.layers, NewLocalBitSet(f.layer(last).bits))
+		l.counts = append(l.counts, 0)
+	}
+	if err := l.layers[last].set(ctx, f.locations(last, data)); err != nil {
+		return false, err
+	}
+	l.counts[last]++
+	l.total++
+
+	return true, nil
+}
+
+func (l *localScalable) check(ctx context.Context, f *ScalableFilter, data []byte) (bool, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.exists(ctx, f, data)
+}
+
+func (l *localScalable) count(_ context.Context) (uint64, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.total, nil
+}
+
+func (l *localScalable) exists(ctx context.Context, f *ScalableFilter, data []byte) (bool, error) {
+	for i, layer := range l.layers {
+		exists, err := layer.check(ctx, f.locations(i, data))
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,236 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrIncompatible indicates the filters have different parameters or backends.
+	ErrIncompatible = errors.New("incompatible bloom filters")
+	// ErrNoFilters indicates no filters are given.
+	ErrNoFilters = errors.New("no bloom filters")
+)
+
+type setOp int
+
+// unionSuffix is the temporary key of the union to estimate an intersection.
+const unionSuffix = ":union"
+
+const (
+	opUnion setOp = iota
+	opIntersect
+)
+
+// setCounts is the bits set in each filter, their union and their intersection.
+type setCounts struct {
+	filters   []uint64
+	union     uint64
+	intersect uint64
+}
+
+// Union returns an in-process Filter of all items in filters, and the estimated number of them.
+// The filters must have the same bits, maps and hash version, and can be redis backed or local.
+func Union(filters ...*Filter) (*Filter, float64, error) {
+	return UnionCtx(context.Background(), filters...)
+}
+
+// UnionCtx is Union with context.
+func UnionCtx(ctx context.Context, filters ...*Filter) (*Filter, float64, error) {
+	return combineLocal(ctx, opUnion, filters)
+}
+
+// Intersect returns an in-process Filter of the items in all filters, and the estimated
+// number of them. The result may report items that are only in some of filters.
+func Intersect(filters ...*Filter) (*Filter, float64, error) {
+	return IntersectCtx(context.Background(), filters...)
+}
+
+// IntersectCtx is Intersect with context.
+func IntersectCtx(ctx context.Context, filters ...*Filter) (*Filter, float64, error) {
+	return combineLocal(ctx, opIntersect, filters)
+}
+
+// UnionInto stores the union of filters backed by store into dest with BITOP OR,
+// like a weekly filter of daily ones, and returns the Filter on dest and the estimated
+// number of items. The parameters are stored with dest, so it can be opened with Open.
+func UnionInto(store *redis.Client, dest string, filters ...*Filter) (*Filter, float64, error) {
+	return UnionIntoCtx(context.Background(), store, dest, filters...)
+}
+
+// UnionIntoCtx is UnionInto with context.
+func UnionIntoCtx(ctx context.Context, store *redis.Client, dest string, filters ...*Filter) (*Filter, float64, error) {
+	return combineRedis(ctx, opUnion, store, dest, filters)
+}
+
+// IntersectInto stores the intersection of filters backed by store into dest with BITOP AND,
+// see UnionInto.
+func IntersectInto(store *redis.Client, dest string, filters ...*Filter) (*Filter, float64, error) {
+	return IntersectIntoCtx(context.Background(), store, dest, filters...)
+}
+
+// IntersectIntoCtx is IntersectInto with context.
+func IntersectIntoCtx(ctx context.Context, store *redis.Client, dest string,
+	filters ...*Filter) (*Filter, float64, error) {
+	return combineRedis(ctx, opIntersect, store, dest, filters)
+}
+
+func combineLocal(ctx context.Context, op setOp, filters []*Filter) (*Filter, float64, error) {
+	if err := checkCompatible(filters); err != nil {
+		return nil, 0, err
+	}
+
+	sources := make([]rangeBitSet, len(filters))
+	for i, f := range filters {
+		src, ok := f.rangeBitSet()
+		if !ok {
+			return nil, 0, ErrIncompatible
+		}
+		sources[i] = src
+	}
+
+	first := filters[0]
+	dst := newLocalFilter(first.bits, first.maps, first.version)
+	target := dst.bitSet.(rangeBitSet)
+	counts := setCounts{filters: make([]uint64, len(filters))}
+	chunk := make([]byte, snapshotChunk)
+	union := make([]byte, snapshotChunk)
+	intersect := make([]byte, snapshotChunk)
+	err := copyRanges(ctx, first.bits, func(start int64, buf []byte) error {
+		n := len(buf)
+		for i, src := range sources {
+			if err := src.readRange(ctx, start, chunk[:n]); err != nil {
+				return err
+			}
+
+			for j, b := range chunk[:n] {
+				if i == 0 {
+					union[j], intersect[j] = b, b
+				} else {
+					union[j] |= b
+					intersect[j] &= b
+				}
+			}
+			counts.filters[i] += popCount(chunk[:n])
+		}
+		counts.union += popCount(union[:n])
+		counts.intersect += popCount(intersect[:n])
+
+		if op == opUnion {
+			return target.writeRange(ctx, start, union[:n])
+		}
+		return target.writeRange(ctx, start, intersect[:n])
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return dst, counts.estimate(op, first.bits, first.maps), nil
+}
+
+func combineRedis(ctx context.Context, op setOp, store *redis.Client, dest string,
+	filters []*Filter) (*Filter, float64, error) {
+	if err := checkCompatible(filters); err != nil {
+		return nil, 0, err
+	}
+
+	keys := make([]string, len(filters))
+	for i, f := range filters {
+		// BITOP reads the filters on store, a filter on another redis would be read as empty
+		bitSet, ok := f.bitSet.(*redisBitSet)
+		if !ok || bitSet.store != store {
+			return nil, 0, ErrIncompatible
+		}
+		keys[i] = bitSet.key
+	}
+
+	// the union is needed to estimate the intersection of two filters
+	unionKey := dest
+	if op == opIntersect {
+		unionKey = dest + unionSuffix
+	}
+
+	first := filters[0]
+	var filterCmds []*redis.IntCmd
+	var unionCmd, destCmd *redis.IntCmd
+	_, err := store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.BitOpOr(ctx, unionKey, keys...)
+		if op == opIntersect {
+			pipe.BitOpAnd(ctx, dest, keys...)
+			for _, key := range keys {
+				filterCmds = append(filterCmds, pipe.BitCount(ctx, key, nil))
+			}
+			unionCmd = pipe.BitCount(ctx, unionKey, nil)
+			pipe.Del(ctx, unionKey)
+		}
+		destCmd = pipe.BitCount(ctx, dest, nil)
+		pipe.HSet(ctx, metaKey(dest), metaBitsField, uint64(first.bits), metaMapsField, uint64(first.maps),
+			metaVersionField, uint8(first.version))
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	counts := setCounts{
+		union:     uint64(destCmd.Val()),
+		intersect: uint64(destCmd.Val()),
+	}
+	if op == opIntersect {
+		counts.union = uint64(unionCmd.Val())
+		for _, cmd := range filterCmds {
+			counts.filters = append(counts.filters, uint64(cmd.Val()))
+		}
+	}
+
+	return newRedisFilter(store, dest, first.bits, first.maps, first.version),
+		counts.estimate(op, first.bits, first.maps), nil
+}
+
+func checkCompatible(filters []*Filter) error {
+	if len(filters) == 0 {
+		return ErrNoFilters
+	}
+
+	first := filters[0]
+	for _, f := range filters {
+		if f.bits != first.bits || f.maps != first.maps || f.version != first.version || f.shards > 1 {
+			return ErrIncompatible
+		}
+	}
+
+	return nil
+}
+
+// estimate returns the estimated number of items of the result, the union is estimated
+// from its bits set. The intersection of two filters is estimated with n(A)+n(B)-n(A∪B),
+// that of more filters is estimated from the bits set in all of them, which overestimates.
+func (c setCounts) estimate(op setOp, size, maps uint) float64 {
+	if op == opUnion {
+		return newStats(size, maps, c.union).EstimatedItems
+	}
+
+	if len(c.filters) != 2 {
+		return newStats(size, maps, c.intersect).EstimatedItems
+	}
+
+	items := newStats(size, maps, c.filters[0]).EstimatedItems + newStats(size, maps, c.filters[1]).EstimatedItems -
+		newStats(size, maps, c.union).EstimatedItems
+	if items < 0 {
+		return 0
+	}
+
+	return items
+}
+
+func popCount(data []byte) uint64 {
+	var count int
+	for _, b := range data {
+		count += bits.OnesCount8(b)
+	}
+
+	return uint64(count)
+}
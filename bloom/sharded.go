@@ -0,0 +1,166 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	// maxShardBits is the max bits of a redis string.
+	maxShardBits = 1 << 32
+	// shardSeed keeps the shard of an item independent of its locations.
+	shardSeed = 0x9747b28c
+)
+
+// ErrInvalidShards indicates the shards can't hold the bits.
+var ErrInvalidShards = errors.New("invalid bloom shards")
+
+type redisShardedBitSet struct {
+	store     redis.UniversalClient
+	key       string
+	shards    uint
+	shardBits uint
+}
+
+// NewSharded creates a Filter whose bits are split across shards redis keys,
+// which lifts the 2^32 bits limit of one key and spreads the load in a cluster.
+// All locations of an item are in one shard, so each operation is still one round trip.
+// Each shard key is hash tagged as {key:i}, store can be a redis.ClusterClient.
+func NewSharded(store redis.UniversalClient, key string, bits, shards uint) (*Filter, error) {
+	if shards == 0 || bits == 0 {
+		return nil, ErrInvalidShards
+	}
+
+	shardBits := (bits + shards - 1) / shards
+	if uint64(shardBits) > maxShardBits {
+		return nil, ErrInvalidShards
+	}
+
+	return &Filter{
+		bits:    shardBits * shards,
+		maps:    maps,
+		version: HashV2,
+		shards:  shards,
+		bitSet: &redisShardedBitSet{
+			store:     store,
+			key:       key,
+			shards:    shards,
+			shardBits: shardBits,
+		},
+	}, nil
+}
+
+// MinShards returns the least shards to hold bits in redis.
+func MinShards(bits uint) uint {
+	return uint((uint64(bits) + maxShardBits - 1) / maxShardBits)
+}
+
+func (r *redisShardedBitSet) buildOffsetArgs(offsets []uint) (uint, []interface{}, error) {
+	if len(offsets) == 0 {
+		return 0, nil, nil
+	}
+
+	shard := offsets[0] / r.shardBits
+	args := make([]interface{}, 0, len(offsets))
+	for _, offset := range offsets {
+		if offset/r.shardBits != shard || shard >= r.shards {
+			return 0, nil, ErrTooLargeOffset
+		}
+
+		args = append(args, strconv.FormatUint(uint64(offset-shard*r.shardBits), 10))
+	}
+
+	return shard, args, nil
+}
+
+func (r *redisShardedBitSet) check(ctx context.Context, offsets []uint) (bool, error) {
+	shard, args, err := r.buildOffsetArgs(offsets)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := testScript.Run(ctx, r.store, []string{r.shardKey(shard)}, args...).Result()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	exists, ok := resp.(int64)
+	if !ok {
+		return false, nil
+	}
+
+	return exists == 1, nil
+}
+
+func (r *redisShardedBitSet) set(ctx context.Context, offsets []uint) error {
+	shard, args, err := r.buildOffsetArgs(offsets)
+	if err != nil {
+		return err
+	}
+
+	_, err = setScript.Run(ctx, r.store, []string{r.shardKey(shard)}, args...).Result()
+	if err == redis.Nil {
+		return nil
+	}
+
+	return err
+}
+
+func (r *redisShardedBitSet) checkMany(ctx context.Context, offsets [][]uint) ([]bool, error) {
+	batches, err := r.buildBatches(offsets, strconv.Itoa(len(offsets[0])))
+	if err != nil {
+		return nil, err
+	}
+
+	return checkBatches(ctx, r.store, batches, len(offsets))
+}
+
+func (r *redisShardedBitSet) setMany(ctx context.Context, offsets [][]uint) error {
+	batches, err := r.buildBatches(offsets)
+	if err != nil {
+		return err
+	}
+
+	_, err = evalBatches(ctx, r.store, setScript, batches)
+	return err
+}
+
+// buildBatches groups items by shard, all batches are sent in one pipeline.
+func (r *redisShardedBitSet) buildBatches(offsets [][]uint, head ...interface{}) ([]scriptBatch, error) {
+	items := make(map[uint][][]interface{})
+	indexes := make(map[uint][]int)
+	var shards []uint
+	for i, item := range offsets {
+		shard, args, err := r.buildOffsetArgs(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := items[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		items[shard] = append(items[shard], args)
+		indexes[shard] = append(indexes[shard], i)
+	}
+
+	var batches []scriptBatch
+	for _, shard := range shards {
+		batches = append(batches, chunkItems(r.shardKey(shard), items[shard], indexes[shard], head...)...)
+	}
+
+	return batches, nil
+}
+
+func (r *redisShardedBitSet) shardKey(shard uint) string {
+	return "{" + r.key + ":" + strconv.FormatUint(uint64(shard), 10) + "}"
+}
+
+func shardOf(data []byte, shards uint) uint {
+	return uint(murmur3.Sum64WithSeed(data, shardSeed) % uint64(shards))
+}
@@ -0,0 +1,335 @@
+package bloom
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A snapshot is a header, the bitset in redis byte order, where bit n is the bit 7-n%8
+// of byte n/8, and the IEEE crc32 of both, all integers are big endian.
+const (
+	snapshotMagic  = "BLMF"
+	snapshotFormat = 1
+	// snapshotChunk is how many bytes are transferred with redis in each GETRANGE or SETRANGE.
+	snapshotChunk = 1 << 20
+	loadingSuffix = ":loading"
+	// maxSnapshotMaps is far more than any estimate needs, even with the smallest float64 p.
+	maxSnapshotMaps = 1 << 10
+)
+
+// MaxSnapshotBits is the max bits of a snapshot, the same as the max bits of a redis string,
+// larger filters need NewSharded.
+const MaxSnapshotBits = maxShardBits
+
+var (
+	// ErrInvalidSnapshot indicates the snapshot is corrupted or not a bloom snapshot.
+	ErrInvalidSnapshot = errors.New("invalid bloom snapshot")
+	// ErrSnapshotUnsupported indicates the filter can't be saved or loaded as a snapshot.
+	ErrSnapshotUnsupported = errors.New("bloom snapshot unsupported")
+)
+
+type (
+	snapshotHeader struct {
+		Magic   [4]byte
+		Format  uint8
+		Version uint8
+		_       [2]byte
+		Maps    uint32
+		Bits    uint64
+	}
+
+	// rangeBitSet is a bitSetProvider that transfers bytes in redis byte order.
+	rangeBitSet interface {
+		readRange(ctx context.Context, start int64, buf []byte) error
+		writeRange(ctx context.Context, start int64, data []byte) error
+	}
+)
+
+// Save writes f as a snapshot into w.
+func (f *Filter) Save(w io.Writer) error {
+	return f.SaveCtx(context.Background(), w)
+}
+
+// SaveCtx writes f as a snapshot into w with context,
+// a redis backed f is read in chunks with GETRANGE.
+// ErrSnapshotUnsupported is returned if f has more than MaxSnapshotBits bits.
+func (f *Filter) SaveCtx(ctx context.Context, w io.Writer) error {
+	src, ok := f.rangeBitSet()
+	if !ok || uint64(f.bits) > MaxSnapshotBits {
+		return ErrSnapshotUnsupported
+	}
+
+	checksum := crc32.NewIEEE()
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, checksum)
+	if err := binary.Write(out, binary.BigEndian, f.snapshotHeader()); err != nil {
+		return err
+	}
+
+	err := copyRanges(ctx, f.bits, func(start int64, buf []byte) error {
+		if err := src.readRange(ctx, start, buf); err != nil {
+			return err
+		}
+
+		_, err := out.Write(buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := binary.Write(bw, binary.BigEndian, checksum.Sum32()); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Load reads a snapshot from r into an in-process Filter.
+func Load(r io.Reader) (*Filter, error) {
+	return load(context.Background(), r, func(header snapshotHeader) (*Filter, rangeBitSet) {
+		f := newLocalFilter(uint(header.Bits), uint(header.Maps), HashVersion(header.Version))
+		return f, f.bitSet.(rangeBitSet)
+	}, nil)
+}
+
+// LoadRedis reads a snapshot from r into a redis backed Filter on key,
+// see LoadRedisCtx.
+func LoadRedis(store *redis.Client, key string, r io.Reader) (*Filter, error) {
+	return LoadRedisCtx(context.Background(), store, key, r)
+}
+
+// LoadRedisCtx reads a snapshot from r into a redis backed Filter on key with context.
+// The bitset is written in chunks with SETRANGE into a temporary key, which replaces key
+// after the snapshot is verified, the parameters are stored like NewWithEstimates,
+// so the filter can be opened with Open.
+func LoadRedisCtx(ctx context.Context, store *redis.Client, key string, r io.Reader) (*Filter, error) {
+	loadingKey := key + loadingSuffix
+	if err := store.Del(ctx, loadingKey).Err(); err != nil {
+		return nil, err
+	}
+
+	var header snapshotHeader
+	f, err := load(ctx, r, func(h snapshotHeader) (*Filter, rangeBitSet) {
+		header = h
+		f := newRedisFilter(store, loadingKey, uint(h.Bits), uint(h.Maps), HashVersion(h.Version))
+		return f, f.bitSet.(rangeBitSet)
+	}, func() error {
+		_, err := store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, loadingKey, key)
+			pipe.HSet(ctx, metaKey(key), metaBitsField, header.Bits, metaMapsField, header.Maps,
+				metaVersionField, header.Version)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		store.Del(ctx, loadingKey)
+		return nil, err
+	}
+
+	return newRedisFilter(store, key, f.bits, f.maps, f.version), nil
+}
+
+// ToLocal copies f into an in-process Filter, the copy doesn't follow later changes of f.
+func (f *Filter) ToLocal() (*Filter, error) {
+	return f.ToLocalCtx(context.Background())
+}
+
+// ToLocalCtx copies f into an in-process Filter with context.
+func (f *Filter) ToLocalCtx(ctx context.Context) (*Filter, error) {
+	dst := newLocalFilter(f.bits, f.maps, f.version)
+	if err := f.copyTo(ctx, dst); err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// ToRedis copies f into a redis backed Filter on key, see LoadRedisCtx.
+func (f *Filter) ToRedis(store *redis.Client, key string) (*Filter, error) {
+	return f.ToRedisCtx(context.Background(), store, key)
+}
+
+// ToRedisCtx copies f into a redis backed Filter on key with context.
+func (f *Filter) ToRedisCtx(ctx context.Context, store *redis.Client, key string) (*Filter, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(f.SaveCtx(ctx, pw))
+	}()
+
+	dst, err := LoadRedisCtx(ctx, store, key, pr)
+	pr.Close()
+	return dst, err
+}
+
+func (f *Filter) copyTo(ctx context.Context, dst *Filter) error {
+	src, ok := f.rangeBitSet()
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+	target, ok := dst.rangeBitSet()
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+
+	return copyRanges(ctx, f.bits, func(start int64, buf []byte) error {
+		if err := src.readRange(ctx, start, buf); err != nil {
+			return err
+		}
+
+		return target.writeRange(ctx, start, buf)
+	})
+}
+
+func (f *Filter) rangeBitSet() (rangeBitSet, bool) {
+	if f.shards > 1 {
+		return nil, false
+	}
+
+	bitSet, ok := f.bitSet.(rangeBitSet)
+	return bitSet, ok
+}
+
+func (f *Filter) snapshotHeader() snapshotHeader {
+	header := snapshotHeader{
+		Format:  snapshotFormat,
+		Version: uint8(f.version),
+		Maps:    uint32(f.maps),
+		Bits:    uint64(f.bits),
+	}
+	copy(header.Magic[:], snapshotMagic)
+
+	return header
+}
+
+// load reads a snapshot from r into the filter made by create,
+// commit is called after the snapshot is verified.
+func load(ctx context.Context, r io.Reader, create func(header snapshotHeader) (*Filter, rangeBitSet),
+	commit func() error) (*Filter, error) {
+	// the input length is known for readers like bytes.Reader and strings.Reader,
+	// it's taken before bufio reads ahead
+	size := -1
+	if lr, ok := r.(interface{ Len() int }); ok {
+		size = lr.Len()
+	}
+	checksum := crc32.NewIEEE()
+	in := io.TeeReader(bufio.NewReader(r), checksum)
+
+	var header snapshotHeader
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		return nil, ErrInvalidSnapshot
+	}
+	// check the sizes before the bitset is allocated, the checksum is only known at the end
+	if string(header.Magic[:]) != snapshotMagic || header.Format != snapshotFormat ||
+		!validParams(header.Bits, uint64(header.Maps), HashVersion(header.Version)) {
+		return nil, ErrInvalidSnapshot
+	}
+	if size >= 0 && uint64(size) < snapshotSize(header.Bits) {
+		return nil, ErrInvalidSnapshot
+	}
+
+	f, dst := create(header)
+	err := copyRanges(ctx, f.bits, func(start int64, buf []byte) error {
+		if _, err := io.ReadFull(in, buf); err != nil {
+			return ErrInvalidSnapshot
+		}
+
+		return dst.writeRange(ctx, start, buf)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sum := checksum.Sum32()
+	var expected uint32
+	if err := binary.Read(in, binary.BigEndian, &expected); err != nil || expected != sum {
+		return nil, ErrInvalidSnapshot
+	}
+
+	if commit != nil {
+		if err := commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// snapshotSize returns the size of a snapshot of bits.
+func snapshotSize(bits uint64) uint64 {
+	return uint64(binary.Size(snapshotHeader{})) + (bits+7)/8 + 4
+}
+
+// copyRanges calls fn with each chunk of a bitset of total bits.
+func copyRanges(ctx context.Context, total uint, fn func(start int64, buf []byte) error) error {
+	size := int64(total+7) / 8
+	buf := make([]byte, snapshotChunk)
+	for start := int64(0); start < size; start += snapshotChunk {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n := size - start
+		if n > snapshotChunk {
+			n = snapshotChunk
+		}
+		if err := fn(start, buf[:n]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *redisBitSet) readRange(ctx context.Context, start int64, buf []byte) error {
+	data, err := r.store.GetRange(ctx, r.key, start, start+int64(len(buf))-1).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	// the bytes after the end of the key are all zero
+	n := copy(buf, data)
+	for i := n; i < len(buf); i++ {
+		buf[i] = 0
+	}
+
+	return nil
+}
+
+func (r *redisBitSet) writeRange(ctx context.Context, start int64, data []byte) error {
+	return r.store.SetRange(ctx, r.key, start, string(data)).Err()
+}
+
+func (l *LocalBitSet) readRange(_ context.Context, start int64, buf []byte) error {
+	for i := range buf {
+		offset := uint(start+int64(i)) * 8
+		word := atomic.LoadUint64(&l.words[offset>>6])
+		buf[i] = bits.Reverse8(uint8(word >> (offset & 63)))
+	}
+
+	return nil
+}
+
+// writeRange sets the bits in data, it's used to fill a new LocalBitSet.
+func (l *LocalBitSet) writeRange(_ context.Context, start int64, data []byte) error {
+	for i, b := range data {
+		if b == 0 {
+			continue
+		}
+
+		offset := uint(start+int64(i)) * 8
+		addr := &l.words[offset>>6]
+		atomic.StoreUint64(addr, atomic.LoadUint64(addr)|uint64(bits.Reverse8(b))<<(offset&63))
+	}
+
+	return nil
+}
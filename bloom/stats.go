@@ -0,0 +1,137 @@
+package bloom
+
+import (
+	"context"
+	"math"
+	"math/bits"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type (
+	// Stats is the saturation of a Filter.
+	Stats struct {
+		Bits uint
+		Maps uint
+		// BitsSet is how many bits are set.
+		BitsSet uint64
+		// FillRatio is BitsSet/Bits.
+		FillRatio float64
+		// EstimatedItems is the Swamidass–Baldi estimate of added items:
+		// -bits/maps*ln(1-FillRatio), it's +Inf if all bits are set.
+		EstimatedItems float64
+		// FalsePositiveRate is the expected false positive rate now: FillRatio^maps.
+		FalsePositiveRate float64
+	}
+
+	statsAlert struct {
+		target float64
+		fn     func(Stats)
+	}
+)
+
+// SetAlert makes Stats call fn when the false positive rate exceeds target.
+// A nil fn removes the alert.
+func (f *Filter) SetAlert(target float64, fn func(Stats)) {
+	if fn == nil {
+		f.alert.Store((*statsAlert)(nil))
+		return
+	}
+
+	f.alert.Store(&statsAlert{
+		target: target,
+		fn:     fn,
+	})
+}
+
+// Stats returns the saturation of f, counted with BITCOUNT in redis or popcount in process.
+func (f *Filter) Stats() (Stats, error) {
+	return f.StatsCtx(context.Background())
+}
+
+// StatsCtx returns the saturation of f with context.
+func (f *Filter) StatsCtx(ctx context.Context) (Stats, error) {
+	set, err := f.bitSet.count(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := newStats(f.bits, f.maps, set)
+	if alert, ok := f.alert.Load().(*statsAlert); ok && alert != nil && stats.FalsePositiveRate > alert.target {
+		alert.fn(stats)
+	}
+
+	return stats, nil
+}
+
+func newStats(bits, maps uint, set uint64) Stats {
+	stats := Stats{
+		Bits:    bits,
+		Maps:    maps,
+		BitsSet: set,
+	}
+	if bits == 0 {
+		return stats
+	}
+
+	stats.FillRatio = float64(set) / float64(bits)
+	if stats.FillRatio >= 1 {
+		stats.FillRatio = 1
+		stats.EstimatedItems = math.Inf(1)
+	} else {
+		stats.EstimatedItems = -float64(bits) / float64(maps) * math.Log1p(-stats.FillRatio)
+	}
+	stats.FalsePositiveRate = math.Pow(stats.FillRatio, float64(maps))
+
+	return stats
+}
+
+func (r *redisBitSet) count(ctx context.Context) (uint64, error) {
+	set, err := r.store.BitCount(ctx, r.key, nil).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return set, err
+}
+
+func (r *redisShardedBitSet) count(ctx context.Context) (uint64, error) {
+	cmds := make([]*redis.IntCmd, r.shards)
+	_, err := r.store.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range cmds {
+			cmds[i] = pipe.BitCount(ctx, r.shardKey(uint(i)), nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var set uint64
+	for _, cmd := range cmds {
+		set += uint64(cmd.Val())
+	}
+
+	return set, nil
+}
+
+func (l *LocalBitSet) count(_ context.Context) (uint64, error) {
+	var set int
+	for i := range l.words {
+		set += bits.OnesCount64(atomic.LoadUint64(&l.words[i]))
+	}
+
+	return uint64(set), nil
+}
+
+// String returns the stats like bits=1000 maps=14 set=120 fill=0.1200 items=9 fp=1.28e-13.
+func (s Stats) String() string {
+	return "bits=" + strconv.FormatUint(uint64(s.Bits), 10) +
+		" maps=" + strconv.FormatUint(uint64(s.Maps), 10) +
+		" set=" + strconv.FormatUint(s.BitsSet, 10) +
+		" fill=" + strconv.FormatFloat(s.FillRatio, 'f', 4, 64) +
+		" items=" + strconv.FormatFloat(s.EstimatedItems, 'f', 0, 64) +
+		" fp=" + strconv.FormatFloat(s.FalsePositiveRate, 'g', 3, 64)
+}
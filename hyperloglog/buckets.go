@@ -0,0 +1,263 @@
+package hyperloglog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Hourly and Daily are the periods of buckets.
+const (
+	Hourly Period = iota + 1
+	Daily
+)
+
+// sweepInterval is how often expired local buckets are removed.
+const sweepInterval = time.Minute
+
+var (
+	// ErrInvalidPeriod indicates the period of buckets is unknown.
+	ErrInvalidPeriod = errors.New("invalid bucket period")
+	// ErrInvalidRange indicates the start of a range is after its end.
+	ErrInvalidRange = errors.New("invalid bucket range")
+)
+
+type (
+	// Period is how long the items of a bucket are added in.
+	Period int
+
+	// Buckets counts unique items in a HyperLogLog for each hour or day, like daily unique
+	// users per API, and counts the unique items over ranges of them, like weekly ones.
+	// Buckets are kept for the retention after they end.
+	Buckets struct {
+		period    Period
+		prefix    string
+		retention time.Duration
+		loc       *time.Location
+		store     bucketsProvider
+		nowFunc   func() time.Time
+	}
+
+	bucketsProvider interface {
+		add(ctx context.Context, key string, expireAt time.Time, data [][]byte) (bool, error)
+		// bucket returns the HyperLogLog of key, or nil if key doesn't exist.
+		bucket(key string) *HyperLogLog
+	}
+)
+
+// NewBuckets creates redis backed Buckets, store is the backed redis, the key of each bucket
+// is prefix:time, like prefix:20240102 for a day or prefix:2024010215 for an hour,
+// in the time zone of loc. Buckets expire in redis after the retention.
+func NewBuckets(store *redis.Client, prefix string, period Period, retention time.Duration,
+	loc *time.Location) (*Buckets, error) {
+	return newBuckets(&redisBuckets{store: store}, prefix, period, retention, loc)
+}
+
+// NewLocalBuckets creates in-process Buckets, see NewBuckets.
+// Expired buckets are removed every minute on adding.
+func NewLocalBuckets(period Period, retention time.Duration, loc *time.Location) (*Buckets, error) {
+	return newBuckets(&localBuckets{
+		buckets: make(map[string]*localBucket),
+	}, "", period, retention, loc)
+}
+
+func newBuckets(store bucketsProvider, prefix string, period Period, retention time.Duration,
+	loc *time.Location) (*Buckets, error) {
+	if period != Hourly && period != Daily {
+		return nil, ErrInvalidPeriod
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	return &Buckets{
+		period:    period,
+		prefix:    prefix,
+		retention: retention,
+		loc:       loc,
+		store:     store,
+		nowFunc:   time.Now,
+	}, nil
+}
+
+// Add adds data into the bucket of now.
+func (b *Buckets) Add(data ...[]byte) (bool, error) {
+	return b.AddAtCtx(context.Background(), b.nowFunc(), data...)
+}
+
+// AddCtx adds data into the bucket of now with context.
+func (b *Buckets) AddCtx(ctx context.Context, data ...[]byte) (bool, error) {
+	return b.AddAtCtx(ctx, b.nowFunc(), data...)
+}
+
+// AddAt adds data into the bucket of t, like for late events.
+func (b *Buckets) AddAt(t time.Time, data ...[]byte) (bool, error) {
+	return b.AddAtCtx(context.Background(), t, data...)
+}
+
+// AddAtCtx adds data into the bucket of t with context.
+func (b *Buckets) AddAtCtx(ctx context.Context, t time.Time, data ...[]byte) (bool, error) {
+	start := b.start(t)
+	return b.store.add(ctx, b.key(start), b.next(start).Add(b.retention), data)
+}
+
+// Bucket returns the HyperLogLog of the bucket of t, local Buckets return nil
+// if the bucket doesn't exist.
+func (b *Buckets) Bucket(t time.Time) *HyperLogLog {
+	return b.store.bucket(b.key(b.start(t)))
+}
+
+// Count returns the estimated number of unique items in the buckets from the one of start
+// to the one of end, both included.
+func (b *Buckets) Count(start, end time.Time) (uint64, error) {
+	return b.CountCtx(context.Background(), start, end)
+}
+
+// CountCtx is Count with context.
+func (b *Buckets) CountCtx(ctx context.Context, start, end time.Time) (uint64, error) {
+	hlls, err := b.buckets(start, end)
+	if err != nil {
+		return 0, err
+	}
+	if len(hlls) == 0 {
+		return 0, nil
+	}
+
+	return CountCtx(ctx, hlls...)
+}
+
+// MergeInto merges the buckets from the one of start to the one of end into dst,
+// like keeping the weekly unique users after the daily buckets expire.
+func (b *Buckets) MergeInto(dst *HyperLogLog, start, end time.Time) error {
+	return b.MergeIntoCtx(context.Background(), dst, start, end)
+}
+
+// MergeIntoCtx is MergeInto with context.
+func (b *Buckets) MergeIntoCtx(ctx context.Context, dst *HyperLogLog, start, end time.Time) error {
+	hlls, err := b.buckets(start, end)
+	if err != nil {
+		return err
+	}
+
+	return MergeCtx(ctx, dst, hlls...)
+}
+
+func (b *Buckets) buckets(start, end time.Time) ([]*HyperLogLog, error) {
+	if start.After(end) {
+		return nil, ErrInvalidRange
+	}
+
+	var hlls []*HyperLogLog
+	for t := b.start(start); !t.After(end); t = b.next(t) {
+		if h := b.store.bucket(b.key(t)); h != nil {
+			hlls = append(hlls, h)
+		}
+	}
+
+	return hlls, nil
+}
+
+func (b *Buckets) key(start time.Time) string {
+	if b.period == Hourly {
+		return b.prefix + ":" + start.Format("2006010215")
+	}
+
+	return b.prefix + ":" + start.Format("20060102")
+}
+
+// start returns the start of the bucket of t, hours and days start in loc,
+// which keeps them aligned in zones with half hour offsets and across daylight saving changes.
+func (b *Buckets) start(t time.Time) time.Time {
+	t = t.In(b.loc)
+	if b.period == Hourly {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, b.loc)
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, b.loc)
+}
+
+func (b *Buckets) next(start time.Time) time.Time {
+	if b.period == Hourly {
+		return start.Add(time.Hour)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
+
+type redisBuckets struct {
+	store *redis.Client
+}
+
+func (r *redisBuckets) add(ctx context.Context, key string, expireAt time.Time, data [][]byte) (bool, error) {
+	args := make([]interface{}, len(data))
+	for i, d := range data {
+		args[i] = d
+	}
+
+	var changed *redis.IntCmd
+	_, err := r.store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		changed = pipe.PFAdd(ctx, key, args...)
+		pipe.PExpireAt(ctx, key, expireAt)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return changed.Val() == 1, nil
+}
+
+func (r *redisBuckets) bucket(key string) *HyperLogLog {
+	// PFCOUNT and PFMERGE take missing keys as empty
+	return New(r.store, key)
+}
+
+type (
+	localBuckets struct {
+		lock      sync.Mutex
+		buckets   map[string]*localBucket
+		nextSweep time.Time
+	}
+
+	localBucket struct {
+		hll      *HyperLogLog
+		expireAt time.Time
+	}
+)
+
+func (l *localBuckets) add(ctx context.Context, key string, expireAt time.Time, data [][]byte) (bool, error) {
+	l.lock.Lock()
+	if now := time.Now(); now.After(l.nextSweep) {
+		for k, b := range l.buckets {
+			if !now.Before(b.expireAt) {
+				delete(l.buckets, k)
+			}
+		}
+		l.nextSweep = now.Add(sweepInterval)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &localBucket{
+			hll:      NewLocal(),
+			expireAt: expireAt,
+		}
+		l.buckets[key] = b
+	}
+	l.lock.Unlock()
+
+	return b.hll.AddCtx(ctx, data...)
+}
+
+func (l *localBuckets) bucket(key string) *HyperLogLog {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if b, ok := l.buckets[key]; ok && time.Now().Before(b.expireAt) {
+		return b.hll
+	}
+
+	return nil
+}
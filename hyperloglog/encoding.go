@@ -0,0 +1,123 @@
+package hyperloglog
+
+// The value of a HyperLogLog in redis is a 16-byte header, "HYLL", the encoding,
+// 3 unused bytes and the cached count in little endian, followed by the registers.
+// The dense encoding packs the 6-bit registers from the least significant bits,
+// the sparse encoding is run length encoded with the ZERO, XZERO and VAL opcodes.
+const (
+	magic        = "HYLL"
+	headerSize   = 16
+	encodingByte = 4
+	cardByte     = 8
+	registerBits = 6
+	registerMax  = 1<<registerBits - 1
+	denseSize    = headerSize + (registers*registerBits+7)/8
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	// the highest bit of the cached count marks the cache as invalid.
+	invalidCache = 1 << 7
+
+	// the opcodes of the sparse encoding.
+	opZero     = 0x00
+	opXZero    = 0x40
+	opMask     = 0xc0
+	sparseVals = 5
+)
+
+// encodeDense returns regs in the dense encoding, the cached count is marked invalid,
+// so that redis counts it on the next PFCOUNT.
+func encodeDense(regs []uint8) []byte {
+	data := make([]byte, denseSize)
+	copy(data, magic)
+	data[encodingByte] = encodingDense
+	data[cardByte+7] = invalidCache
+
+	dense := data[headerSize:]
+	for i, v := range regs {
+		pos := uint(i) * registerBits
+		b, fb := pos/8, pos%8
+		dense[b] |= v << fb
+		if b+1 < uint(len(dense)) {
+			dense[b+1] |= v >> (8 - fb)
+		}
+	}
+
+	return data
+}
+
+// decode returns the registers of a redis value, in the dense or the sparse encoding.
+func decode(data []byte) ([]uint8, error) {
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, ErrInvalidHyperLogLog
+	}
+
+	switch data[encodingByte] {
+	case encodingDense:
+		return decodeDense(data)
+	case encodingSparse:
+		return decodeSparse(data[headerSize:])
+	default:
+		return nil, ErrInvalidHyperLogLog
+	}
+}
+
+func decodeDense(data []byte) ([]uint8, error) {
+	if len(data) != denseSize {
+		return nil, ErrInvalidHyperLogLog
+	}
+
+	dense := data[headerSize:]
+	regs := make([]uint8, registers)
+	for i := range regs {
+		pos := uint(i) * registerBits
+		b, fb := pos/8, pos%8
+		v := dense[b] >> fb
+		if b+1 < uint(len(dense)) {
+			v |= dense[b+1] << (8 - fb)
+		}
+		regs[i] = v & registerMax
+	}
+
+	return regs, nil
+}
+
+func decodeSparse(sparse []byte) ([]uint8, error) {
+	regs := make([]uint8, registers)
+	var index int
+	for i := 0; i < len(sparse); i++ {
+		op := sparse[i]
+		var runLen int
+		switch {
+		case op&opMask == opZero:
+			runLen = int(op&^opMask) + 1
+		case op&opMask == opXZero:
+			if i+1 >= len(sparse) {
+				return nil, ErrInvalidHyperLogLog
+			}
+			i++
+			runLen = (int(op&^opMask)<<8 | int(sparse[i])) + 1
+		default:
+			runLen = int(op&0x3) + 1
+			if index+runLen > registers {
+				return nil, ErrInvalidHyperLogLog
+			}
+			v := (op>>2)&(1<<sparseVals-1) + 1
+			for j := index; j < index+runLen; j++ {
+				regs[j] = v
+			}
+		}
+
+		index += runLen
+		if index > registers {
+			return nil, ErrInvalidHyperLogLog
+		}
+	}
+
+	if index != registers {
+		return nil, ErrInvalidHyperLogLog
+	}
+
+	return regs, nil
+}
@@ -0,0 +1,122 @@
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// the parameters of redis, see hyperloglog.c in redis.
+const (
+	precision = 14
+	registers = 1 << precision
+	// q is the number of hash bits used for the run of zeros.
+	q = 64 - precision
+	// alphaInf is the bias correction constant of the estimator.
+	alphaInf = 0.721347520444481703680
+	hashSeed = 0xadc83b19
+)
+
+// patLen returns the register of data, and the length of the run of zeros plus one,
+// the same as hllPatLen in redis.
+func patLen(data []byte) (uint, uint8) {
+	hash := murmurHash64A(data, hashSeed)
+	index := uint(hash & (registers - 1))
+	// the sentinel bit makes sure the loop ends
+	hash >>= precision
+	hash |= 1 << q
+
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+
+	return index, count
+}
+
+// murmurHash64A is the 64-bit MurmurHash2 used by redis, which reads
+// the blocks in little endian.
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const (
+		m = 0xc6a4a7935bd1e995
+		r = 47
+	)
+
+	h := seed ^ (uint64(len(data)) * m)
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+
+	return h
+}
+
+// estimate returns the estimated count of regs with the estimator of redis,
+// see "New cardinality estimation algorithms for HyperLogLog sketches" by Otmar Ertl.
+func estimate(regs []uint8) uint64 {
+	var histogram [64]int
+	for _, v := range regs {
+		histogram[v]++
+	}
+
+	m := float64(registers)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
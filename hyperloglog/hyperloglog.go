@@ -0,0 +1,276 @@
+package hyperloglog
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// mergingSuffix is the temporary key to merge local registers into a redis HyperLogLog.
+const mergingSuffix = ":merging"
+
+var (
+	// ErrInvalidHyperLogLog indicates the value is not a HyperLogLog in redis encoding.
+	ErrInvalidHyperLogLog = errors.New("invalid hyperloglog")
+	// ErrNoHyperLogLogs indicates no HyperLogLogs are given.
+	ErrNoHyperLogLogs = errors.New("no hyperloglogs")
+)
+
+type (
+	// A HyperLogLog estimates the number of unique items with a standard error of 0.81%
+	// in 12KB, like daily unique users. Both backends use the hash, registers and
+	// estimator of redis, so the same items have the same count in both.
+	HyperLogLog struct {
+		store hllProvider
+	}
+
+	hllProvider interface {
+		add(ctx context.Context, data [][]byte) (bool, error)
+		count(ctx context.Context) (uint64, error)
+		registers(ctx context.Context) ([]uint8, error)
+		merge(ctx context.Context, regs []uint8) error
+	}
+)
+
+// New creates a redis backed HyperLogLog, store is the backed redis, key is the key of it,
+// it's operated with PFADD, PFCOUNT and PFMERGE.
+func New(store *redis.Client, key string) *HyperLogLog {
+	return &HyperLogLog{
+		store: &redisHyperLogLog{
+			store: store,
+			key:   key,
+		},
+	}
+}
+
+// NewLocal creates an in-process HyperLogLog.
+func NewLocal() *HyperLogLog {
+	return &HyperLogLog{
+		store: newLocalHyperLogLog(),
+	}
+}
+
+// Parse creates an in-process HyperLogLog from a redis value got with GET,
+// both the sparse and the dense encodings are supported.
+func Parse(data []byte) (*HyperLogLog, error) {
+	regs, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HyperLogLog{
+		store: &localHyperLogLog{
+			regs: regs,
+		},
+	}, nil
+}
+
+// Add adds data into h, like PFADD, it returns true if the estimated count may be changed.
+func (h *HyperLogLog) Add(data ...[]byte) (bool, error) {
+	return h.AddCtx(context.Background(), data...)
+}
+
+// AddCtx adds data into h with context.
+func (h *HyperLogLog) AddCtx(ctx context.Context, data ...[]byte) (bool, error) {
+	return h.store.add(ctx, data)
+}
+
+// Count returns the estimated number of unique items in h, like PFCOUNT.
+func (h *HyperLogLog) Count() (uint64, error) {
+	return h.CountCtx(context.Background())
+}
+
+// CountCtx returns the estimated number of unique items in h with context.
+func (h *HyperLogLog) CountCtx(ctx context.Context) (uint64, error) {
+	return h.store.count(ctx)
+}
+
+// Bytes returns h in the dense encoding of redis, which can be stored with SET,
+// or loaded with Parse.
+func (h *HyperLogLog) Bytes() ([]byte, error) {
+	return h.BytesCtx(context.Background())
+}
+
+// BytesCtx returns h in the dense encoding of redis with context.
+func (h *HyperLogLog) BytesCtx(ctx context.Context) ([]byte, error) {
+	regs, err := h.store.registers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeDense(regs), nil
+}
+
+// ToLocal copies h into an in-process HyperLogLog.
+func (h *HyperLogLog) ToLocal() (*HyperLogLog, error) {
+	return h.ToLocalCtx(context.Background())
+}
+
+// ToLocalCtx copies h into an in-process HyperLogLog with context.
+func (h *HyperLogLog) ToLocalCtx(ctx context.Context) (*HyperLogLog, error) {
+	regs, err := h.store.registers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HyperLogLog{
+		store: &localHyperLogLog{
+			regs: regs,
+		},
+	}, nil
+}
+
+// ToRedis copies h into key of store, the existing value of key is replaced.
+func (h *HyperLogLog) ToRedis(store *redis.Client, key string) (*HyperLogLog, error) {
+	return h.ToRedisCtx(context.Background(), store, key)
+}
+
+// ToRedisCtx copies h into key of store with context.
+func (h *HyperLogLog) ToRedisCtx(ctx context.Context, store *redis.Client, key string) (*HyperLogLog, error) {
+	data, err := h.BytesCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.Set(ctx, key, data, 0).Err(); err != nil {
+		return nil, err
+	}
+
+	return New(store, key), nil
+}
+
+// Count returns the estimated number of unique items in the union of hlls, like PFCOUNT
+// with multiple keys. The union is counted by redis if all of hlls are on the same redis.
+func Count(hlls ...*HyperLogLog) (uint64, error) {
+	return CountCtx(context.Background(), hlls...)
+}
+
+// CountCtx is Count with context.
+func CountCtx(ctx context.Context, hlls ...*HyperLogLog) (uint64, error) {
+	if len(hlls) == 0 {
+		return 0, ErrNoHyperLogLogs
+	}
+
+	if store, keys, ok := sameRedis(hlls); ok {
+		return redisCount(ctx, store, keys)
+	}
+
+	regs, err := union(ctx, hlls)
+	if err != nil {
+		return 0, err
+	}
+
+	return estimate(regs), nil
+}
+
+// Merge merges srcs into dst, like PFMERGE, dst then counts the union of itself and srcs.
+// The merge is done by redis if all of them are on the same redis.
+func Merge(dst *HyperLogLog, srcs ...*HyperLogLog) error {
+	return MergeCtx(context.Background(), dst, srcs...)
+}
+
+// MergeCtx is Merge with context.
+func MergeCtx(ctx context.Context, dst *HyperLogLog, srcs ...*HyperLogLog) error {
+	if len(srcs) == 0 {
+		return nil
+	}
+
+	if _, keys, ok := sameRedis(append([]*HyperLogLog{dst}, srcs...)); ok {
+		r := dst.store.(*redisHyperLogLog)
+		return r.store.PFMerge(ctx, r.key, keys[1:]...).Err()
+	}
+
+	regs, err := union(ctx, srcs)
+	if err != nil {
+		return err
+	}
+
+	return dst.store.merge(ctx, regs)
+}
+
+// sameRedis returns the redis and the keys of hlls, if all of them are on the same redis.
+func sameRedis(hlls []*HyperLogLog) (*redis.Client, []string, bool) {
+	var store *redis.Client
+	keys := make([]string, len(hlls))
+	for i, h := range hlls {
+		r, ok := h.store.(*redisHyperLogLog)
+		if !ok || (store != nil && r.store != store) {
+			return nil, nil, false
+		}
+		store = r.store
+		keys[i] = r.key
+	}
+
+	return store, keys, true
+}
+
+func union(ctx context.Context, hlls []*HyperLogLog) ([]uint8, error) {
+	result := make([]uint8, registers)
+	for _, h := range hlls {
+		regs, err := h.store.registers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		mergeRegisters(result, regs)
+	}
+
+	return result, nil
+}
+
+type redisHyperLogLog struct {
+	store *redis.Client
+	key   string
+}
+
+func (r *redisHyperLogLog) add(ctx context.Context, data [][]byte) (bool, error) {
+	args := make([]interface{}, len(data))
+	for i, d := range data {
+		args[i] = d
+	}
+
+	changed, err := r.store.PFAdd(ctx, r.key, args...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return changed == 1, nil
+}
+
+func (r *redisHyperLogLog) count(ctx context.Context) (uint64, error) {
+	return redisCount(ctx, r.store, []string{r.key})
+}
+
+func (r *redisHyperLogLog) registers(ctx context.Context) ([]uint8, error) {
+	data, err := r.store.Get(ctx, r.key).Bytes()
+	if err == redis.Nil {
+		return make([]uint8, registers), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decode(data)
+}
+
+// merge stores regs into a temporary key, and merges it with PFMERGE,
+// so that the items added meanwhile are kept.
+func (r *redisHyperLogLog) merge(ctx context.Context, regs []uint8) error {
+	tmp := r.key + mergingSuffix
+	_, err := r.store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, tmp, encodeDense(regs), 0)
+		pipe.PFMerge(ctx, r.key, tmp)
+		pipe.Del(ctx, tmp)
+		return nil
+	})
+
+	return err
+}
+
+func redisCount(ctx context.Context, store *redis.Client, keys []string) (uint64, error) {
+	count, err := store.PFCount(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(count), nil
+}
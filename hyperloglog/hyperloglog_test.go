@@ -0,0 +1,374 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The fixtures are captured from redis with
+//
+//	REDIS_ADDR=127.0.0.1:6379 go test ./hyperloglog -run TestRedis -update
+//
+// TestRedisLive compares with redis directly whenever REDIS_ADDR is set.
+const fixturesFile = "testdata/redis_fixtures.json"
+
+var update = flag.Bool("update", false, "capture "+fixturesFile+" from the redis on REDIS_ADDR")
+
+type redisFixture struct {
+	// Items are item:0 to item:Items-1, added with one PFADD.
+	Items    int    `json:"items"`
+	Encoding string `json:"encoding"`
+	// Value is the hex of GET after PFADD, before PFCOUNT updates the cached count.
+	Value   string `json:"value"`
+	PFCount uint64 `json:"pfcount"`
+}
+
+// fixtureItems covers the sparse encoding, the switch to dense at 3000 bytes,
+// and the dense encoding up to both ends of the estimator.
+var fixtureItems = []int{0, 1, 3, 10, 100, 1000, 3000, 10000, 100000, 1000000}
+
+func items(n int) [][]byte {
+	data := make([][]byte, n)
+	for i := range data {
+		data[i] = []byte("item:" + strconv.Itoa(i))
+	}
+	return data
+}
+
+func testRedis(t *testing.T) *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+
+	store := redis.NewClient(&redis.Options{Addr: addr})
+	if err := store.Ping(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// captureFixture adds the items into redis, and returns the value and PFCOUNT of it.
+func captureFixture(t *testing.T, store *redis.Client, n int) redisFixture {
+	ctx := context.Background()
+	key := "hyperloglog:test:" + strconv.Itoa(n)
+	if err := store.Del(ctx, key).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Del(ctx, key)
+
+	args := make([]interface{}, 0, n)
+	for _, item := range items(n) {
+		args = append(args, item)
+	}
+	if n == 0 {
+		// PFADD without items creates an empty HyperLogLog
+		err := store.Do(ctx, "pfadd", key).Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for start := 0; start < len(args); start += 10000 {
+		end := start + 10000
+		if end > len(args) {
+			end = len(args)
+		}
+		if err := store.PFAdd(ctx, key, args[start:end]...).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	value, err := store.Get(ctx, key).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := store.PFCount(ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoding := "dense"
+	if value[encodingByte] == encodingSparse {
+		encoding = "sparse"
+	}
+	return redisFixture{
+		Items:    n,
+		Encoding: encoding,
+		Value:    hex.EncodeToString(value),
+		PFCount:  uint64(count),
+	}
+}
+
+func checkFixture(t *testing.T, fixture redisFixture) {
+	value, err := hex.DecodeString(fixture.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := Parse(value)
+	if err != nil {
+		t.Fatalf("items=%d %s: %v", fixture.Items, fixture.Encoding, err)
+	}
+	if count, _ := h.Count(); count != fixture.PFCount {
+		t.Errorf("items=%d %s: Parse().Count() = %d, PFCOUNT = %d", fixture.Items, fixture.Encoding,
+			count, fixture.PFCount)
+	}
+
+	// the same hash and registers as redis
+	local := NewLocal()
+	if _, err := local.Add(items(fixture.Items)...); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := decode(value)
+	got, _ := local.store.registers(context.Background())
+	if !bytes.Equal(got, want) {
+		t.Errorf("items=%d %s: local registers differ from redis", fixture.Items, fixture.Encoding)
+	}
+	if count, _ := local.Count(); count != fixture.PFCount {
+		t.Errorf("items=%d: local count = %d, PFCOUNT = %d", fixture.Items, count, fixture.PFCount)
+	}
+}
+
+func TestRedisFixtures(t *testing.T) {
+	if *update {
+		store := testRedis(t)
+		var fixtures []redisFixture
+		for _, n := range fixtureItems {
+			fixtures = append(fixtures, captureFixture(t, store, n))
+		}
+		data, err := json.MarshalIndent(fixtures, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fixturesFile, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(fixturesFile)
+	if os.IsNotExist(err) {
+		t.Skip("no " + fixturesFile + ", capture it with -update")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	var fixtures []redisFixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		checkFixture(t, fixture)
+	}
+}
+
+func TestRedisLive(t *testing.T) {
+	store := testRedis(t)
+	for _, n := range fixtureItems {
+		checkFixture(t, captureFixture(t, store, n))
+	}
+}
+
+// The examples of PFADD, PFCOUNT and PFMERGE in the redis documentation.
+func TestRedisDocExamples(t *testing.T) {
+	add := func(h *HyperLogLog, items ...string) {
+		for _, item := range items {
+			if _, err := h.Add([]byte(item)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	count := func(hlls ...*HyperLogLog) uint64 {
+		n, err := Count(hlls...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	hll := NewLocal()
+	add(hll, "a", "b", "c", "d", "e", "f", "g")
+	if n := count(hll); n != 7 {
+		t.Errorf("PFADD hll a b c d e f g, PFCOUNT = %d, want 7", n)
+	}
+
+	hll = NewLocal()
+	add(hll, "foo", "bar", "zap")
+	add(hll, "zap", "zap", "zap")
+	add(hll, "foo", "bar")
+	if n := count(hll); n != 3 {
+		t.Errorf("PFCOUNT hll = %d, want 3", n)
+	}
+	other := NewLocal()
+	add(other, "1", "2", "3")
+	if n := count(hll, other); n != 6 {
+		t.Errorf("PFCOUNT hll some-other-hll = %d, want 6", n)
+	}
+
+	hll1, hll2, hll3 := NewLocal(), NewLocal(), NewLocal()
+	add(hll1, "foo", "bar", "zap", "a")
+	add(hll2, "a", "b", "c", "foo")
+	if err := Merge(hll3, hll1, hll2); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(hll3); n != 6 {
+		t.Errorf("PFMERGE hll3 hll1 hll2, PFCOUNT = %d, want 6", n)
+	}
+}
+
+// An empty HyperLogLog of redis is the header and one XZERO of all registers,
+// see createHLLObject in redis.
+func TestParseEmpty(t *testing.T) {
+	empty := append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f, 0xff)
+	h, err := Parse(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := h.Count(); n != 0 {
+		t.Fatalf("count = %d, want 0", n)
+	}
+
+	h, err = Parse(encodeDense(make([]uint8, registers)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := h.Count(); n != 0 {
+		t.Fatalf("dense count = %d, want 0", n)
+	}
+}
+
+func randomRegisters(r *rand.Rand, max int) []uint8 {
+	regs := make([]uint8, registers)
+	for i := range regs {
+		regs[i] = uint8(r.Intn(max + 1))
+	}
+	return regs
+}
+
+func TestDenseRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	full := make([]uint8, registers)
+	for i := range full {
+		full[i] = registerMax
+	}
+
+	for _, regs := range [][]uint8{make([]uint8, registers), full, randomRegisters(r, registerMax),
+		randomRegisters(r, 3)} {
+		data := encodeDense(regs)
+		if len(data) != denseSize || string(data[:4]) != magic || data[encodingByte] != encodingDense {
+			t.Fatalf("invalid dense header % x", data[:headerSize])
+		}
+		got, err := decodeDense(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, regs) {
+			t.Fatal("dense round trip differs")
+		}
+	}
+
+	if _, err := decodeDense(make([]byte, denseSize-1)); err != ErrInvalidHyperLogLog {
+		t.Fatalf("short dense: %v", err)
+	}
+}
+
+// encodeSparse encodes regs with the opcodes of redis, ZERO for up to 64 zeros,
+// XZERO for up to 16384 zeros, VAL for up to 4 registers of a value up to 32.
+func encodeSparse(regs []uint8) []byte {
+	data := []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80")
+	for i := 0; i < len(regs); {
+		j := i
+		for j < len(regs) && regs[j] == regs[i] {
+			j++
+		}
+		for run := j - i; run > 0; {
+			switch {
+			case regs[i] != 0:
+				n := run
+				if n > 4 {
+					n = 4
+				}
+				data = append(data, 0x80|(regs[i]-1)<<2|uint8(n-1))
+				run -= n
+			case run > 64:
+				n := run
+				if n > 16384 {
+					n = 16384
+				}
+				data = append(data, opXZero|uint8((n-1)>>8), uint8(n-1))
+				run -= n
+			default:
+				data = append(data, uint8(run-1))
+				run = 0
+			}
+		}
+		i = j
+	}
+	return data
+}
+
+func TestSparseMatchesDense(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	sparse := make([]uint8, registers)
+	for i := 0; i < 500; i++ {
+		sparse[r.Intn(registers)] = uint8(r.Intn(32) + 1)
+	}
+
+	local := NewLocal()
+	if _, err := local.Add(items(1000)...); err != nil {
+		t.Fatal(err)
+	}
+	added, _ := local.store.registers(context.Background())
+
+	for _, regs := range [][]uint8{make([]uint8, registers), sparse, added, randomRegisters(r, 32)} {
+		got, err := decode(encodeSparse(regs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, regs) {
+			t.Fatal("sparse decoding differs")
+		}
+
+		fromSparse, _ := Parse(encodeSparse(regs))
+		fromDense, _ := Parse(encodeDense(regs))
+		n1, _ := fromSparse.Count()
+		n2, _ := fromDense.Count()
+		if n1 != n2 {
+			t.Fatalf("sparse count %d, dense count %d", n1, n2)
+		}
+	}
+
+	// the runs must cover exactly all registers
+	for _, data := range [][]byte{
+		append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f, 0xfe),
+		append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f, 0xff, 0x00),
+		append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f),
+	} {
+		if _, err := Parse(data); err != ErrInvalidHyperLogLog {
+			t.Errorf("% x: %v", data[headerSize:], err)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		h := NewLocal()
+		if _, err := h.Add(items(n)...); err != nil {
+			t.Fatal(err)
+		}
+		count, _ := h.Count()
+		// 3 standard errors of 0.81%
+		if diff := float64(count)/float64(n) - 1; diff > 0.025 || diff < -0.025 {
+			t.Errorf("count of %d items = %d", n, count)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package hyperloglog
+
+import (
+	"context"
+	"sync"
+)
+
+type localHyperLogLog struct {
+	lock sync.RWMutex
+	// regs has a register in each byte, unlike the 6-bit registers of redis.
+	regs []uint8
+}
+
+func newLocalHyperLogLog() *localHyperLogLog {
+	return &localHyperLogLog{
+		regs: make([]uint8, registers),
+	}
+}
+
+func (l *localHyperLogLog) add(_ context.Context, data [][]byte) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var changed bool
+	for _, d := range data {
+		index, count := patLen(d)
+		if count > l.regs[index] {
+			l.regs[index] = count
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+func (l *localHyperLogLog) count(_ context.Context) (uint64, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return estimate(l.regs), nil
+}
+
+func (l *localHyperLogLog) registers(_ context.Context) ([]uint8, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	regs := make([]uint8, registers)
+	copy(regs, l.regs)
+
+	return regs, nil
+}
+
+func (l *localHyperLogLog) merge(_ context.Context, regs []uint8) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	mergeRegisters(l.regs, regs)
+
+	return nil
+}
+
+func mergeRegisters(dst, src []uint8) {
+	for i, v := range src {
+		if v > dst[i] {
+			dst[i] = v
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultIdle idle<=0时的清理时间，为0时每次取限流器都会清理，限流失效
+const defaultIdle = time.Minute * 10
+
+type keyCtx struct{}
+
+type (
+	// Keyed 按key复用限流器，如按用户、IP限流，key由WithKey放入ctx
+	// 超过idle未使用的限流器会被清理，进程内令牌桶的idle应不小于填满桶的时间
+	Keyed struct {
+		mu        sync.Mutex
+		limiters  map[string]*keyedEntry
+		newFunc   func(key string) Limiter
+		idle      time.Duration
+		nextSweep time.Time
+		nowFunc   func() time.Time
+		observe   func(key string)
+	}
+
+	keyedEntry struct {
+		limiter  Limiter
+		lastUsed time.Time
+	}
+)
+
+// NewKeyed 初始函数
+// idle -- 限流器未使用多久后清理，<=0时为defaultIdle；newFunc -- 创建key的限流器，如
+// func(key string) Limiter { return NewRedisTokenBucket(store, "limit:"+key, 10, 20, nil) }
+func NewKeyed(idle time.Duration, newFunc func(key string) Limiter) *Keyed {
+	if idle <= 0 {
+		idle = defaultIdle
+	}
+
+	return &Keyed{
+		limiters: make(map[string]*keyedEntry),
+		newFunc:  newFunc,
+		idle:     idle,
+		nowFunc:  time.Now,
+	}
+}
+
+// WithKey 返回带限流key的ctx
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyCtx{}, key)
+}
+
+// Get 返回key的限流器，不存在时创建
+func (k *Keyed) Get(key string) Limiter {
+	now := k.nowFunc()
+
+	k.mu.Lock()
+	k.sweep(now)
+	entry, ok := k.limiters[key]
+	if !ok {
+		entry = &keyedEntry{limiter: k.newFunc(key)}
+		k.limiters[key] = entry
+	}
+	entry.lastUsed = now
+	observe := k.observe
+	k.mu.Unlock()
+
+	if observe != nil {
+		observe(key)
+	}
+
+	return entry.limiter
+}
+
+// SetObserver 设置每次取key限流器时的回调，在锁外调用，nil表示取消
+// 如用sketch.TopK统计热点key：
+// topK.SetAlert(1000, func(item sketch.Item) { log.Println("hot key", item.Key) })
+// keyed.SetObserver(func(key string) { topK.Incr(key, 1) })
+func (k *Keyed) SetObserver(fn func(key string)) {
+	k.mu.Lock()
+	k.observe = fn
+	k.mu.Unlock()
+}
+
+func (k *Keyed) Allow(ctx context.Context) (bool, error) {
+	return k.AllowN(ctx, 1)
+}
+
+func (k *Keyed) AllowN(ctx context.Context, n int) (bool, error) {
+	l, err := k.fromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return l.AllowN(ctx, n)
+}
+
+func (k *Keyed) Reserve(ctx context.Context, n int) (time.Duration, error) {
+	l, err := k.fromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return l.Reserve(ctx, n)
+}
+
+func (k *Keyed) Wait(ctx context.Context, n int) error {
+	l, err := k.fromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return l.Wait(ctx, n)
+}
+
+func (k *Keyed) fromContext(ctx context.Context) (Limiter, error) {
+	key, ok := ctx.Value(keyCtx{}).(string)
+	if !ok {
+		return nil, ErrNoKey
+	}
+
+	return k.Get(key), nil
+}
+
+// sweep 每idle清理一次过期的限流器
+func (k *Keyed) sweep(now time.Time) {
+	if now.Before(k.nextSweep) {
+		return
+	}
+
+	for key, entry := range k.limiters {
+		if now.Sub(entry.lastUsed) >= k.idle {
+			delete(k.limiters, key)
+		}
+	}
+	k.nextSweep = now.Add(k.idle)
+}
@@ -0,0 +1,111 @@
+// Package limiter 限流器
+// 进程内令牌桶、redis令牌桶、redis滑动日志及按key复用的限流器均实现Limiter接口
+package limiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrExceedsLimit n超过桶容量或窗口上限，永远无法满足
+	ErrExceedsLimit = errors.New("limiter: n exceeds limit")
+	// ErrWouldExceedDeadline 需等待的时间超过ctx的截止时间，未消耗配额
+	ErrWouldExceedDeadline = errors.New("limiter: wait would exceed context deadline")
+	// ErrNoKey ctx中没有WithKey设置的key
+	ErrNoKey = errors.New("limiter: no key in context")
+)
+
+// Limiter 限流器，并发安全
+type Limiter interface {
+	// Allow 同AllowN(ctx, 1)
+	Allow(ctx context.Context) (bool, error)
+	// AllowN 立即判断是否允许n个请求，不允许时不消耗配额
+	AllowN(ctx context.Context, n int) (bool, error)
+	// Reserve 预留n个配额，返回需等待的时长，等待后方可执行
+	Reserve(ctx context.Context, n int) (time.Duration, error)
+	// Wait 阻塞直到允许n个请求，ctx结束时返回ctx.Err()
+	// 等待期间ctx结束时，TokenBucket归还预留的配额，redis实现的配额已在redis中扣除，不归还
+	Wait(ctx context.Context, n int) error
+}
+
+// reserver 各实现的核心：预留n个配额并返回需等待的时长
+// 需等待超过maxWait时不预留并返回false，maxWait<0表示不限
+type reserver interface {
+	reserve(ctx context.Context, n int, maxWait time.Duration) (time.Duration, bool, error)
+}
+
+// waiter 可在等待期间ctx结束时归还配额的reserver
+type waiter interface {
+	wait(ctx context.Context, n int, maxWait time.Duration) error
+}
+
+// limiter 基于reserver实现Limiter
+type limiter struct {
+	reserver
+}
+
+func (l limiter) Allow(ctx context.Context) (bool, error) {
+	return l.AllowN(ctx, 1)
+}
+
+func (l limiter) AllowN(ctx context.Context, n int) (bool, error) {
+	_, ok, err := l.reserve(ctx, n, 0)
+	if err == ErrExceedsLimit {
+		return false, nil
+	}
+
+	return ok, err
+}
+
+func (l limiter) Reserve(ctx context.Context, n int) (time.Duration, error) {
+	delay, _, err := l.reserve(ctx, n, -1)
+	return delay, err
+}
+
+func (l limiter) Wait(ctx context.Context, n int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	maxWait := time.Duration(-1)
+	if deadline, ok := ctx.Deadline(); ok {
+		if maxWait = time.Until(deadline); maxWait < 0 {
+			maxWait = 0
+		}
+	}
+
+	if w, ok := l.reserver.(waiter); ok {
+		return w.wait(ctx, n, maxWait)
+	}
+
+	delay, ok, err := l.reserve(ctx, n, maxWait)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWouldExceedDeadline
+	}
+
+	return sleep(ctx, delay)
+}
+
+// sleep 等待d或ctx结束
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"com/limiter"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每个key的限流器，10分钟未使用后清理
+var ml = limiter.NewKeyed(10*time.Minute, func(key string) limiter.Limiter {
+	return limiter.NewTokenBucket(50, 1)
+})
+
+func main() {
+	r := gin.Default()
+	r.GET("/hello", hello)
+
+	r.Run(":8081")
+}
+
+func hello(c *gin.Context) {
+	ctx := limiter.WithKey(c.Request.Context(), c.Query("key"))
+	allow, _ := ml.Allow(ctx)
+	if allow {
+		c.JSON(http.StatusOK, gin.H{"data": "success"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "fail"})
+}
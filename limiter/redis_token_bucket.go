@@ -0,0 +1,135 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 脚本返回的状态
+const (
+	statusExceedsLimit = -1
+	statusTooLong      = 0
+	statusReserved     = 1
+)
+
+var errUnexpectedResponse = errors.New("limiter: unexpected script response")
+
+var tokenBucketScript = redis.NewScript(`
+-- 每秒生产token数量
+local rate = tonumber(ARGV[1])
+-- 桶容量
+local capacity = tonumber(ARGV[2])
+-- 当前时间戳，微秒
+local now = tonumber(ARGV[3])
+-- 当前请求token数量
+local requested = tonumber(ARGV[4])
+-- 最多等待的微秒数，小于0表示不限
+local max_wait = tonumber(ARGV[5])
+
+if requested > capacity then
+	return {-1, 0}
+end
+
+local state = redis.call("hmget", KEYS[1], "tokens", "ts")
+-- 第一次进入时桶是满的
+local last_tokens = tonumber(state[1]) or capacity
+local last_time = tonumber(state[2]) or now
+
+-- 时钟回拨时不生产token
+local delta = math.max(0, now - last_time)
+local filled_tokens = math.min(capacity, last_tokens + delta * rate / 1000000)
+
+-- token不足时预支，等待的时间内生产的token归还预支
+local new_tokens = filled_tokens - requested
+local wait = 0
+if new_tokens < 0 then
+	wait = math.ceil(-new_tokens * 1000000 / rate)
+end
+if max_wait >= 0 and wait > max_wait then
+	return {0, wait}
+end
+
+redis.call("hset", KEYS[1], "tokens", new_tokens, "ts", math.max(now, last_time))
+-- 填满桶后即可删除
+redis.call("pexpire", KEYS[1], math.ceil((capacity - new_tokens) * 1000 / rate) + 1000)
+
+return {1, wait}
+`)
+
+// RedisTokenBucket 分布式令牌桶，多实例共享配额
+// token不足时Reserve和Wait预支后续生产的token，Wait等待期间ctx结束时预支的token不归还
+type RedisTokenBucket struct {
+	limiter
+	rescue
+	key   string
+	rate  string
+	burst string
+}
+
+// NewRedisTokenBucket 初始函数
+// key -- redis key，状态存于该hash；r -- 每秒生产token数量；burst -- 桶容量
+// fallback -- redis故障时使用的进程内令牌桶，为nil时返回redis错误
+// 降级时需按部署机器个数折算，如NewTokenBucket(r/serverNum, burst/serverNum)
+func NewRedisTokenBucket(store *redis.Client, key string, r float64, burst int, fallback *TokenBucket) *RedisTokenBucket {
+	b := &RedisTokenBucket{
+		rescue: newRescue(store, fallback),
+		key:    key,
+		rate:   strconv.FormatFloat(r, 'f', -1, 64),
+		burst:  strconv.Itoa(burst),
+	}
+	b.limiter = limiter{b}
+	return b
+}
+
+func (b *RedisTokenBucket) reserve(ctx context.Context, n int, maxWait time.Duration) (time.Duration, bool, error) {
+	return b.rescue.reserve(ctx, n, maxWait, func() (time.Duration, bool, error) {
+		resp, err := tokenBucketScript.Run(ctx, b.store, []string{b.key},
+			b.rate,
+			b.burst,
+			nowMicro(),
+			strconv.Itoa(n),
+			formatMaxWait(maxWait),
+		).Int64Slice()
+		if err != nil {
+			return 0, false, err
+		}
+
+		return parseReserved(resp)
+	})
+}
+
+// parseReserved 解析脚本返回的{状态, 等待微秒数}
+func parseReserved(resp []int64) (time.Duration, bool, error) {
+	if len(resp) != 2 {
+		return 0, false, errUnexpectedResponse
+	}
+
+	switch resp[0] {
+	case statusExceedsLimit:
+		return 0, false, ErrExceedsLimit
+	case statusTooLong:
+		return 0, false, nil
+	case statusReserved:
+		return time.Duration(resp[1]) * time.Microsecond, true, nil
+	default:
+		return 0, false, errUnexpectedResponse
+	}
+}
+
+// formatMaxWait maxWait转为微秒，-1表示不限
+func formatMaxWait(maxWait time.Duration) string {
+	if maxWait < 0 {
+		return "-1"
+	}
+
+	return strconv.FormatInt(int64(maxWait/time.Microsecond), 10)
+}
+
+// nowMicro 当前时间戳，微秒
+func nowMicro() string {
+	return strconv.FormatInt(time.Now().UnixNano()/int64(time.Microsecond), 10)
+}
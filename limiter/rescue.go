@@ -0,0 +1,93 @@
+package limiter
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const pingInterval = time.Millisecond * 100
+
+// rescue redis故障时降级到进程内令牌桶，并探测redis，恢复后切回redis
+type rescue struct {
+	// 存储容器
+	store *redis.Client
+	// redis故障时采用的进程内令牌桶，为nil时直接返回redis错误
+	fallback *TokenBucket
+	// redis健康标识
+	redisAlive uint32
+	// lock
+	rescueLock sync.Mutex
+	// redis监控探测任务标识
+	monitorStarted bool
+}
+
+func newRescue(store *redis.Client, fallback *TokenBucket) rescue {
+	return rescue{
+		store:      store,
+		fallback:   fallback,
+		redisAlive: 1,
+	}
+}
+
+// reserve redis正常时调用fn，否则使用fallback
+func (r *rescue) reserve(ctx context.Context, n int, maxWait time.Duration,
+	fn func() (time.Duration, bool, error)) (time.Duration, bool, error) {
+	if r.fallback != nil && atomic.LoadUint32(&r.redisAlive) == 0 {
+		return r.fallback.reserve(ctx, n, maxWait)
+	}
+
+	delay, ok, err := fn()
+	if err == nil || err == ErrExceedsLimit || r.fallback == nil || ctx.Err() != nil {
+		return delay, ok, err
+	}
+
+	// todo 日志统一收集
+	log.Printf("fail to use rate limiter: %s, use in-process limiter for rescue", err)
+	r.startMonitor()
+	return r.fallback.reserve(ctx, n, maxWait)
+}
+
+func (r *rescue) startMonitor() {
+	r.rescueLock.Lock()
+	defer r.rescueLock.Unlock()
+
+	if r.monitorStarted {
+		return
+	}
+
+	r.monitorStarted = true
+	atomic.StoreUint32(&r.redisAlive, 0)
+
+	go r.waitForRedis()
+}
+
+func (r *rescue) waitForRedis() {
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		r.rescueLock.Lock()
+		r.monitorStarted = false
+		r.rescueLock.Unlock()
+	}()
+
+	for range ticker.C {
+		if r.ping() {
+			atomic.StoreUint32(&r.redisAlive, 1)
+			log.Println("redis recovery!")
+			return
+		}
+	}
+}
+
+func (r *rescue) ping() bool {
+	result, err := r.store.Ping(context.Background()).Result()
+	if err != nil {
+		return false
+	}
+	return result == "PONG"
+}
@@ -0,0 +1,110 @@
+package limiter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var slidingLogScript = redis.NewScript(`
+-- 窗口内最大请求数
+local limit = tonumber(ARGV[1])
+-- 窗口长度，微秒
+local window = tonumber(ARGV[2])
+-- 当前时间戳，微秒
+local now = tonumber(ARGV[3])
+-- 当前请求数量
+local requested = tonumber(ARGV[4])
+-- 最多等待的微秒数，小于0表示不限
+local max_wait = tonumber(ARGV[5])
+-- 本次请求的唯一标识
+local id = ARGV[6]
+
+if requested > limit then
+	return {-1, 0}
+end
+
+-- 移除窗口外的请求
+redis.call("zremrangebyscore", KEYS[1], "-inf", now - window)
+
+-- 窗口已满时，等第over早的请求移出窗口
+local wait = 0
+local over = redis.call("zcard", KEYS[1]) + requested - limit
+if over > 0 then
+	local entry = redis.call("zrange", KEYS[1], over - 1, over - 1, "withscores")
+	wait = tonumber(entry[2]) + window - now
+end
+if max_wait >= 0 and wait > max_wait then
+	return {0, wait}
+end
+
+-- 预留的请求记在等待结束的时刻
+for i = 1, requested do
+	redis.call("zadd", KEYS[1], now + wait, id .. "-" .. i)
+end
+redis.call("pexpire", KEYS[1], math.ceil((wait + window) / 1000) + 1)
+
+return {1, wait}
+`)
+
+// SlidingLog 分布式滑动日志限流器，任意window时长内最多limit个请求
+// 每个请求记录在redis有序集合中，适合limit不大的场景
+// Wait等待期间ctx结束时，请求记录不删除，仍占用窗口配额
+type SlidingLog struct {
+	limiter
+	rescue
+	key    string
+	limit  string
+	window string
+}
+
+// NewSlidingLog 初始函数
+// key -- redis key，请求记录于该有序集合；limit -- 窗口内最大请求数；window -- 窗口长度
+// fallback -- redis故障时使用的进程内令牌桶，为nil时返回redis错误
+func NewSlidingLog(store *redis.Client, key string, limit int, window time.Duration, fallback *TokenBucket) *SlidingLog {
+	l := &SlidingLog{
+		rescue: newRescue(store, fallback),
+		key:    key,
+		limit:  strconv.Itoa(limit),
+		window: strconv.FormatInt(int64(window/time.Microsecond), 10),
+	}
+	l.limiter = limiter{l}
+	return l
+}
+
+func (l *SlidingLog) reserve(ctx context.Context, n int, maxWait time.Duration) (time.Duration, bool, error) {
+	return l.rescue.reserve(ctx, n, maxWait, func() (time.Duration, bool, error) {
+		id, err := requestID()
+		if err != nil {
+			return 0, false, err
+		}
+
+		resp, err := slidingLogScript.Run(ctx, l.store, []string{l.key},
+			l.limit,
+			l.window,
+			nowMicro(),
+			strconv.Itoa(n),
+			formatMaxWait(maxWait),
+			id,
+		).Int64Slice()
+		if err != nil {
+			return 0, false, err
+		}
+
+		return parseReserved(resp)
+	})
+}
+
+// requestID 随机生成请求标识，保证多实例间有序集合成员不重复
+func requestID() (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf[:]), nil
+}
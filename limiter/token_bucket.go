@@ -0,0 +1,73 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TokenBucket 进程内令牌桶，基于golang.org/x/time/rate
+type TokenBucket struct {
+	limiter
+	lim *rate.Limiter
+}
+
+// NewTokenBucket 初始函数
+// r -- 每秒生产token数量；burst -- 桶容量
+func NewTokenBucket(r float64, burst int) *TokenBucket {
+	b := &TokenBucket{
+		lim: rate.NewLimiter(rate.Limit(r), burst),
+	}
+	b.limiter = limiter{b}
+	return b
+}
+
+func (b *TokenBucket) reserve(_ context.Context, n int, maxWait time.Duration) (time.Duration, bool, error) {
+	_, delay, ok, err := b.reserveAt(time.Now(), n, maxWait)
+	return delay, ok, err
+}
+
+// reserveAt 同reserve，另返回预留的rate.Reservation，maxWait为0时为nil
+func (b *TokenBucket) reserveAt(now time.Time, n int, maxWait time.Duration) (*rate.Reservation, time.Duration, bool, error) {
+	if n > b.lim.Burst() {
+		return nil, 0, false, ErrExceedsLimit
+	}
+
+	if maxWait == 0 {
+		return nil, 0, b.lim.AllowN(now, n), nil
+	}
+
+	r := b.lim.ReserveN(now, n)
+	if !r.OK() {
+		return nil, 0, false, ErrExceedsLimit
+	}
+
+	delay := r.DelayFrom(now)
+	if maxWait > 0 && delay > maxWait {
+		// 归还预留的token
+		r.CancelAt(now)
+		return nil, 0, false, nil
+	}
+
+	return r, delay, true, nil
+}
+
+// wait 等待期间ctx结束时归还预留的token，同rate.Limiter.WaitN
+func (b *TokenBucket) wait(ctx context.Context, n int, maxWait time.Duration) error {
+	r, delay, ok, err := b.reserveAt(time.Now(), n, maxWait)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWouldExceedDeadline
+	}
+
+	if err := sleep(ctx, delay); err != nil {
+		if r != nil {
+			r.CancelAt(time.Now())
+		}
+		return err
+	}
+	return nil
+}
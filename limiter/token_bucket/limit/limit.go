@@ -97,6 +97,8 @@ type TokenLimiter struct {
 }
 
 // NewTokenLimiter 初始函数
+//
+// Deprecated: 使用com/limiter的NewRedisTokenBucket
 // limitServer -- 部署限流器机器个数，如果限流器降级到本地进程，则计算每台机器的限流速度和个数
 func NewTokenLimiter(rate, burst int, store *redis.Client, key string, localServerNum int) *TokenLimiter {
 	tokenKey := fmt.Sprintf(tokenFormat, key)
@@ -1,35 +1,35 @@
 package main
 
 import (
-	"api_module/datasource"
-	"api_module/pkg/limiter"
-	"api_module/pkg/setting"
+	"com/limiter"
+	"context"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"time"
+
+	"github.com/go-redis/redis/v8"
 )
 
 var redisClient *redis.Client
 
 func init() {
-	redConf := &setting.Redis{
-		Host:           "127.0.0.1:6379",
-		Password:       "",
-		MaxIdle:        30,
-		MaxActive:      30,
-		IdleTimeout:    200,
-		MinIdleCons:    100,
-		PoolSize:       5,
-		ConnectTimeout: 30,
-		ReadTimeout:    3,
-		WriteTimeout:   3,
-	}
-	redisClient = datasource.IniRedis(redConf)
+	redisClient = redis.NewClient(&redis.Options{
+		Addr:         "127.0.0.1:6379",
+		Password:     "",
+		PoolSize:     5,
+		MinIdleConns: 100,
+		DialTimeout:  30 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+	})
 }
 func main() {
-	tokenLimiter := limiter.NewTokenLimiter(redisClient, 2)
+	// 部署2台机器，redis故障时每台机器按一半速率限流
+	tokenLimiter := limiter.NewKeyed(time.Minute, func(key string) limiter.Limiter {
+		return limiter.NewRedisTokenBucket(redisClient, key, 1, 2, limiter.NewTokenBucket(0.5, 1))
+	})
+	ctx := limiter.WithKey(context.Background(), "aaa")
 	for i := 0; i < 10000; i++ {
-		allow := tokenLimiter.Allow("aaa", 1, 2)
+		allow, _ := tokenLimiter.Allow(ctx)
 		if allow {
 			fmt.Println("allow")
 		} else {
@@ -1,8 +1,9 @@
-package main
+// Package sign
+// API参数签名：参数排序拼接后按Signer计算签名
+package sign
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/url"
 	"reflect"
@@ -11,25 +12,66 @@ import (
 	"strings"
 )
 
-const SignKey = "sign"
+const (
+	SignKey   = "sign"
+	AppKeyKey = "app_key"
+)
+
+var (
+	// ErrDuplicateParam 参数同时出现在query与json body中
+	ErrDuplicateParam = errors.New("sign: parameter in both query and json body")
+	// ErrUnsupportedBody body非空但Content-Type不参与签名，handler仍可绑定body，因此拒绝
+	ErrUnsupportedBody = errors.New("sign: unsupported content type of request body")
+)
 
+// Verify 校验md5(参数串+salt)签名
 func Verify(salt string, arguments map[string]string) bool {
-	sign := arguments[SignKey]
-	data := joinArguments(arguments) + salt
-	h := md5.New()
-	h.Write([]byte(data))
-	return hex.EncodeToString(h.Sum(nil)) == sign
+	return VerifyWith(NewMD5Signer(salt), arguments[SignKey], arguments)
 }
 
+// Create 生成md5(参数串+salt)签名
 func Create(salt string, arguments interface{}) string {
-	data := joinArguments(arguments) + salt
-	h := md5.New()
-	h.Write([]byte(data))
+	sign, _ := NewMD5Signer(salt).Sign(joinArguments(arguments))
+	return sign
+}
+
+// CreateWith 使用指定的Signer对参数签名
+func CreateWith(signer Signer, arguments interface{}) (string, error) {
+	return signer.Sign(joinArguments(arguments))
+}
+
+// VerifyWith 使用指定的Signer校验参数签名
+func VerifyWith(signer Signer, sign string, arguments interface{}) bool {
+	if sign == "" {
+		return false
+	}
+	return signer.Verify(joinArguments(arguments), sign)
+}
+
+// StringToSign 返回参数排序拼接后的待签名串，便于调试
+func StringToSign(arguments interface{}) string {
+	return joinArguments(arguments)
+}
 
-	return hex.EncodeToString(h.Sum(nil))
+// MergeValues 将query、form参数合并进json参数，单值合并为string，多值为[]string；
+// 同名时返回ErrDuplicateParam，避免未签名的值被handler读取
+func MergeValues(arguments map[string]interface{}, values url.Values) (map[string]interface{}, error) {
+	for k := range values {
+		if _, ok := arguments[k]; ok {
+			return nil, ErrDuplicateParam
+		}
+	}
+	for k, vs := range values {
+		if len(vs) == 1 {
+			arguments[k] = vs[0]
+		} else {
+			arguments[k] = vs
+		}
+	}
+	return arguments, nil
 }
 
-// 排序并合并参数拼成字符串
+// 排序并合并参数拼成字符串，url.Values按k=v1&k=v2原样拼接，同EncodeQuery
 func joinArguments(data interface{}) string {
 	if val, ok := data.(url.Values); ok {
 		if val == nil {
@@ -58,63 +100,8 @@ func joinArguments(data interface{}) string {
 		return buf.String()
 	}
 
-	rType := reflect.TypeOf(data)
-	rValue := reflect.ValueOf(data)
-
-	var keys []string
-	var keyMapper = make(map[string]int)
-	var keyMapper2 = make(map[string]reflect.Value)
-	var r func(reflect.Value, string)
-	var result []string
-
-	switch rType.Kind() {
-	case reflect.Map:
-		for _, k := range rValue.MapKeys() {
-			if String(k) == SignKey {
-				continue
-			}
-			keyMapper2[String(k)] = k
-			keys = append(keys, String(k))
-		}
-	case reflect.Struct:
-		for i := 0; i < rType.NumField(); i++ {
-			fType := rType.Field(i)
-			tags := strings.TrimSpace(fType.Tag.Get("json"))
-			if tags == SignKey || tags == "-" {
-				continue
-			}
-			keys = append(keys, fType.Tag.Get("json"))
-			keyMapper[tags] = i
-		}
-	}
-
-	sort.Strings(keys)
-	r = func(vv reflect.Value, father string) {
-		dat := vv.Interface()
-		v := reflect.ValueOf(dat)
-		t := v.Type()
-		switch t.Kind() {
-		case reflect.Array, reflect.Slice:
-			for i := 0; i < v.Len(); i++ {
-				r(v.Index(i), father+"["+String(i)+"]")
-			}
-		case reflect.Chan, reflect.Func, reflect.Struct, reflect.Map: // map, struct 不保序，上下游不可使用
-			return
-		default:
-			result = append(result, fmt.Sprintf("%s=%s", father, String(v.Interface())))
-		}
-	}
-
-	for _, key := range keys {
-		switch rType.Kind() {
-		case reflect.Map:
-			r(rValue.MapIndex(keyMapper2[key]), key)
-		case reflect.Struct:
-			r(rValue.Field(keyMapper[key]), key)
-		}
-	}
-
-	return strings.Join(result, "&")
+	// map、struct等按canonical.go中的规范展开
+	return strings.Join(appendCanonical(nil, reflect.ValueOf(data), "", true, false), "&")
 }
 
 func String(src interface{}) string {
@@ -0,0 +1,164 @@
+package sign
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const fileCheckInterval = 5 * time.Second
+
+// MemoryAppStore 进程内应用配置
+type MemoryAppStore struct {
+	mu   sync.RWMutex
+	apps map[string]*App
+}
+
+func NewMemoryAppStore(apps ...*App) *MemoryAppStore {
+	s := &MemoryAppStore{apps: make(map[string]*App)}
+	for _, app := range apps {
+		s.apps[app.AppKey] = app
+	}
+	return s
+}
+
+func (s *MemoryAppStore) Get(_ context.Context, appKey string) (*App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	app, ok := s.apps[appKey]
+	if !ok {
+		return nil, ErrUnknownApp
+	}
+	return app, nil
+}
+
+func (s *MemoryAppStore) Set(app *App) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps[app.AppKey] = app
+}
+
+func (s *MemoryAppStore) Delete(appKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.apps, appKey)
+}
+
+// FileAppStore 从json文件加载应用配置（App数组），文件修改后自动重新加载
+type FileAppStore struct {
+	path      string
+	mu        sync.RWMutex
+	apps      map[string]*App
+	modTime   time.Time
+	nextCheck time.Time
+}
+
+func NewFileAppStore(path string) (*FileAppStore, error) {
+	s := &FileAppStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload 重新读取配置文件
+func (s *FileAppStore) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var list []*App
+	if err := json.Unmarshal(content, &list); err != nil {
+		return err
+	}
+	apps := make(map[string]*App, len(list))
+	for _, app := range list {
+		apps[app.AppKey] = app
+	}
+
+	s.mu.Lock()
+	s.apps = apps
+	s.modTime = info.ModTime()
+	s.nextCheck = time.Now().Add(fileCheckInterval)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FileAppStore) Get(_ context.Context, appKey string) (*App, error) {
+	s.checkModified()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	app, ok := s.apps[appKey]
+	if !ok {
+		return nil, ErrUnknownApp
+	}
+	return app, nil
+}
+
+// checkModified 每隔fileCheckInterval检查一次文件修改时间，重新加载失败时保留旧配置
+func (s *FileAppStore) checkModified() {
+	now := time.Now()
+	s.mu.Lock()
+	if now.Before(s.nextCheck) {
+		s.mu.Unlock()
+		return
+	}
+	s.nextCheck = now.Add(fileCheckInterval)
+	modTime := s.modTime
+	s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil || info.ModTime().Equal(modTime) {
+		return
+	}
+	_ = s.Reload()
+}
+
+// RedisAppStore 应用配置以json形式保存在 prefix+appKey
+type RedisAppStore struct {
+	store  *redis.Client
+	prefix string
+}
+
+func NewRedisAppStore(store *redis.Client, prefix string) *RedisAppStore {
+	return &RedisAppStore{
+		store:  store,
+		prefix: prefix,
+	}
+}
+
+func (s *RedisAppStore) Get(ctx context.Context, appKey string) (*App, error) {
+	content, err := s.store.Get(ctx, s.prefix+appKey).Bytes()
+	if err == redis.Nil {
+		return nil, ErrUnknownApp
+	} else if err != nil {
+		return nil, err
+	}
+	app := &App{}
+	if err := json.Unmarshal(content, app); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (s *RedisAppStore) Set(ctx context.Context, app *App) error {
+	content, err := json.Marshal(app)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(ctx, s.prefix+app.AppKey, content, 0).Err()
+}
+
+func (s *RedisAppStore) Delete(ctx context.Context, appKey string) error {
+	return s.store.Del(ctx, s.prefix+appKey).Err()
+}
@@ -0,0 +1,209 @@
+package sign
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 规范化格式（map、struct及嵌套值，url.Values见joinArguments）
+//
+// 输出为若干 path=value 以&连接：
+//   - 顶层只接受map和struct，顶层的sign字段不参与签名
+//   - 顶层key及顶层的标量值（含顶层slice中的标量）保持原样，按String格式化，与旧版签名一致
+//   - 嵌套map、struct内的key和value按escape编码，除A-Z a-z 0-9 - _ . ~外的字节编码为%XX（大写十六进制），
+//     因此嵌套值中的&、=及key中的[、]不会与分隔符混淆
+//   - map、struct逐层按key字节序升序展开，子节点path为 父path[key]，如 a[b][c]=1
+//   - struct字段名取json tag的名称部分（忽略omitempty等选项），无tag取字段名，
+//     tag为"-"及未导出字段忽略，无tag的匿名struct字段展开到当前层
+//   - slice、array按下标展开为 父path[0]、父path[1]…；[]byte视为字符串
+//   - 空map、空struct、空slice不输出
+//   - 指针、interface取其指向的值；nil输出为 path=（空值）
+//   - 实现encoding.TextMarshaler的值（如time.Time）取MarshalText结果
+//   - bool输出true/false；整数十进制；嵌套的浮点数为不带指数的最短表示，如 1000000、0.1、-2.5
+//   - json.Number保持原文，因此json body中的数字按报文中的字面量签名
+//   - chan、func、complex等不输出
+//
+// 例：{"b":[1,{"y":true,"x":null}],"a":{"d":"4","c":1.5,"e":"x&y"},"f":"张三","sign":"..."}
+// 规范化为 a[c]=1.5&a[d]=4&a[e]=x%26y&b[0]=1&b[1][x]=&b[1][y]=true&f=张三
+// 跨语言对照用例见testdata/canonical_vectors.json
+
+const upperHex = "0123456789ABCDEF"
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+type canonicalField struct {
+	name  string
+	index []int
+}
+
+// nested 是否在嵌套的map、struct内，是则key和value按escape编码
+func appendCanonical(result []string, v reflect.Value, path string, top, nested bool) []string {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			v = reflect.Value{}
+			break
+		}
+		if !top && v.Kind() == reflect.Ptr && v.Type().Implements(textMarshalerType) {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		if top {
+			return result
+		}
+		return append(result, path+"=")
+	}
+
+	if !top && v.Type().Implements(textMarshalerType) && v.CanInterface() {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err == nil {
+			return append(result, path+"="+encodeValue(string(text), nested))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		mapKeys := make(map[string]reflect.Value, v.Len())
+		for _, k := range v.MapKeys() {
+			name := String(k.Interface())
+			if top && name == SignKey {
+				continue
+			}
+			keys = append(keys, name)
+			mapKeys[name] = k
+		}
+		sort.Strings(keys)
+		for _, name := range keys {
+			result = appendCanonical(result, v.MapIndex(mapKeys[name]), childPath(path, name, top), false, !top)
+		}
+		return result
+	case reflect.Struct:
+		for _, f := range structFields(v.Type()) {
+			if top && f.name == SignKey {
+				continue
+			}
+			result = appendCanonical(result, v.FieldByIndex(f.index), childPath(path, f.name, top), false, !top)
+		}
+		return result
+	}
+
+	if top {
+		return result
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice {
+				return append(result, path+"="+encodeValue(string(v.Bytes()), nested))
+			}
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return append(result, path+"="+encodeValue(string(b), nested))
+		}
+		for i := 0; i < v.Len(); i++ {
+			result = appendCanonical(result, v.Index(i), path+"["+strconv.Itoa(i)+"]", false, nested)
+		}
+		return result
+	case reflect.String:
+		return append(result, path+"="+encodeValue(v.String(), nested))
+	case reflect.Bool:
+		return append(result, path+"="+strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return append(result, path+"="+strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return append(result, path+"="+strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		if !nested {
+			return append(result, path+"="+String(v.Interface()))
+		}
+		if v.Kind() == reflect.Float32 {
+			return append(result, path+"="+strconv.FormatFloat(v.Float(), 'f', -1, 32))
+		}
+		return append(result, path+"="+strconv.FormatFloat(v.Float(), 'f', -1, 64))
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return result
+	default:
+		return append(result, path+"="+encodeValue(fmt.Sprint(v.Interface()), nested))
+	}
+}
+
+func childPath(path, name string, top bool) string {
+	if top {
+		return name
+	}
+	return path + "[" + escape(name) + "]"
+}
+
+func encodeValue(s string, nested bool) string {
+	if nested {
+		return escape(s)
+	}
+	return s
+}
+
+// escape 除RFC 3986非保留字符外按字节编码为%XX，与url.QueryEscape不同，空格编码为%20
+func escape(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			buf.WriteByte(c)
+			continue
+		}
+		buf.WriteByte('%')
+		buf.WriteByte(upperHex[c>>4])
+		buf.WriteByte(upperHex[c&15])
+	}
+	return buf.String()
+}
+
+// structFields 按名称排序的可签名字段，同名时先出现的优先
+func structFields(t reflect.Type) []canonicalField {
+	var fields []canonicalField
+	seen := make(map[string]bool)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := strings.TrimSpace(f.Tag.Get("json"))
+			if tag == "-" {
+				continue
+			}
+			name := tag
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				name = strings.TrimSpace(tag[:idx])
+			}
+			fieldIndex := append(append([]int(nil), index...), i)
+
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				walk(f.Type, fieldIndex)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			fields = append(fields, canonicalField{name: name, index: fieldIndex})
+		}
+	}
+	walk(t, nil)
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	return fields
+}
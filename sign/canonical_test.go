@@ -0,0 +1,138 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"testing"
+)
+
+type canonicalVector struct {
+	Name         string          `json:"name"`
+	Arguments    json.RawMessage `json:"arguments"`
+	Secret       string          `json:"secret"`
+	StringToSign string          `json:"string_to_sign"`
+	MD5          string          `json:"md5"`
+	MD5HMACSHA1  string          `json:"md5_hmac_sha1"`
+	HMACSHA256   string          `json:"hmac_sha256"`
+}
+
+func loadCanonicalVectors(t *testing.T) []canonicalVector {
+	data, err := ioutil.ReadFile("testdata/canonical_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file struct {
+		Vectors []canonicalVector `json:"vectors"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+	return file.Vectors
+}
+
+// decodeArguments 与ginsign中间件一致，数字保持原文
+func decodeArguments(t *testing.T, raw json.RawMessage) map[string]interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	arguments := make(map[string]interface{})
+	if err := decoder.Decode(&arguments); err != nil {
+		t.Fatal(err)
+	}
+	return arguments
+}
+
+func TestCanonicalVectors(t *testing.T) {
+	for _, v := range loadCanonicalVectors(t) {
+		t.Run(v.Name, func(t *testing.T) {
+			arguments := decodeArguments(t, v.Arguments)
+			if got := StringToSign(arguments); got != v.StringToSign {
+				t.Fatalf("string to sign = %q, want %q", got, v.StringToSign)
+			}
+
+			signers := []struct {
+				signer Signer
+				want   string
+			}{
+				{NewMD5Signer(v.Secret), v.MD5},
+				{NewMD5HMACSHA1Signer(v.Secret), v.MD5HMACSHA1},
+				{NewHMACSHA256Signer(v.Secret), v.HMACSHA256},
+			}
+			for _, s := range signers {
+				got, err := CreateWith(s.signer, arguments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != s.want {
+					t.Errorf("%s = %s, want %s", s.signer.Alg(), got, s.want)
+				}
+				if !VerifyWith(s.signer, s.want, arguments) {
+					t.Errorf("%s: verify failed", s.signer.Alg())
+				}
+			}
+		})
+	}
+}
+
+// 用例的待签名串各不相同，嵌套值中的分隔符已编码
+func TestCanonicalInjective(t *testing.T) {
+	seen := make(map[string]string)
+	for _, v := range loadCanonicalVectors(t) {
+		s := StringToSign(decodeArguments(t, v.Arguments))
+		if name, ok := seen[s]; ok {
+			t.Errorf("%s and %s have the same string to sign %q", name, v.Name, s)
+		}
+		seen[s] = v.Name
+	}
+}
+
+// url.Values与json参数使用同样的编码
+func TestValuesMatchCanonical(t *testing.T) {
+	values := url.Values{"a": {"1&b=2"}, "k v": {"50% off"}}
+	arguments := map[string]interface{}{"a": "1&b=2", "k v": "50% off"}
+	if got, want := StringToSign(values), StringToSign(arguments); got != want {
+		t.Fatalf("url.Values = %q, map = %q", got, want)
+	}
+}
+
+// 顶层参数与旧版一致，原样拼接不编码
+func TestCreateLegacy(t *testing.T) {
+	const secret = "secret"
+	flat := map[string]string{"app_key": "k", "name": "张三", "q": "a b&c", "sign": "x"}
+	values := url.Values{"app_key": {"k"}, "name": {"张三"}, "q": {"a b&c"}, "sign": {"x"}}
+	numbers := map[string]interface{}{"amount": float64(1000000), "app_key": "k", "name": "张三", "q": "a b&c"}
+
+	tests := []struct {
+		arguments interface{}
+		want      string
+	}{
+		// md5("app_key=k&name=张三&q=a b&c" + secret)
+		{flat, "ee2fc05329164a8baad11a42c2823a56"},
+		{values, "ee2fc05329164a8baad11a42c2823a56"},
+		// md5("amount=1e+06&app_key=k&name=张三&q=a b&c" + secret)
+		{numbers, "7fd2dd0dec955bc4d92de277fb1a06e9"},
+	}
+	for _, tt := range tests {
+		if got := Create(secret, tt.arguments); got != tt.want {
+			t.Errorf("Create(%v) = %s, want %s", tt.arguments, got, tt.want)
+		}
+	}
+
+	flat[SignKey] = tests[0].want
+	if !Verify(secret, flat) {
+		t.Error("Verify failed")
+	}
+
+	got, err := CreateWith(NewMD5HMACSHA1Signer(secret), values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := GetSign(values, secret, SignKey); got != want {
+		t.Errorf("md5_hmac_sha1 = %s, GetSign = %s", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+// 签名调试工具，供合作方联调时复现签名
+//
+//	sign -secret aaaaa cc=333 www=34444 aaa=33222
+//	sign -secret aaaaa -query 'cc=333&www=34444&aaa=33222&sign=xxx'
+//	sign -secret aaaaa -json body.json -verify xxx
+//	sign -alg rsa-sha256 -key private.pem -json body.json
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"com"
+	"com/sign"
+)
+
+var (
+	secret   = flag.String("secret", "", "secret/salt for md5, md5-hmac-sha1 and hmac-sha256")
+	alg      = flag.String("alg", "", "only use this algorithm: md5, md5-hmac-sha1, hmac-sha256, rsa-sha256, ed25519")
+	keyFile  = flag.String("key", "", "key file for rsa-sha256 (PEM) or ed25519 (base64), private key to sign, public key to verify")
+	query    = flag.String("query", "", "parameters as a query string")
+	jsonFile = flag.String("json", "", "parameters as a json file, - for stdin")
+	verify   = flag.String("verify", "", "signature to verify, defaults to the sign parameter if present")
+	stamp    = flag.Bool("stamp", false, "add timestamp and nonce parameters before signing")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sign [flags] [key=value ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	arguments, err := loadArguments()
+	if err != nil {
+		fail(err)
+	}
+	expected := *verify
+	if expected == "" {
+		expected = lookup(arguments, sign.SignKey)
+	}
+
+	stringToSign := sign.StringToSign(arguments)
+	fmt.Printf("string to sign:\n  %s\n", stringToSign)
+	if values, ok := arguments.(url.Values); ok {
+		fmt.Printf("EncodeQuery:\n  %s\n", sign.EncodeQuery(values, sign.SignKey))
+	}
+	fmt.Println()
+
+	algs := []string{sign.AlgMD5, sign.AlgMD5HMACSHA1, sign.AlgHMACSHA256}
+	if *alg != "" {
+		algs = []string{*alg}
+	}
+	matched := false
+	for _, name := range algs {
+		signature, ok := run(name, stringToSign, expected)
+		if ok {
+			matched = true
+		}
+		if signature != "" && expected == "" && len(algs) == 1 {
+			fmt.Printf("%s=%s\n", sign.SignKey, url.QueryEscape(signature))
+		}
+	}
+
+	if expected != "" && !matched {
+		os.Exit(1)
+	}
+}
+
+// run 打印一种算法的中间结果和签名，expected非空时校验
+func run(name, stringToSign, expected string) (string, bool) {
+	fmt.Printf("[%s]\n", name)
+	var secretValue string
+	switch name {
+	case sign.AlgMD5:
+		fmt.Printf("  md5 input:       %s\n", stringToSign+*secret)
+	case sign.AlgMD5HMACSHA1:
+		input := stringToSign + "&AppSecret=" + *secret
+		fmt.Printf("  md5 input:       %s\n", input)
+		fmt.Printf("  upper md5:       %s\n", strings.ToUpper(sign.EncodeMD5(input)))
+	case sign.AlgHMACSHA256:
+		fmt.Printf("  hmac input:      %s\n", stringToSign)
+	case sign.AlgRSASHA256, sign.AlgEd25519:
+		if *keyFile == "" {
+			fmt.Printf("  -key is required\n\n")
+			return "", false
+		}
+		content, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			fail(err)
+		}
+		secretValue = string(content)
+	}
+	if secretValue == "" {
+		secretValue = *secret
+	}
+
+	signer, err := sign.NewSigner(name, secretValue)
+	if err != nil {
+		fail(err)
+	}
+	signature, err := signer.Sign(stringToSign)
+	if err == sign.ErrNoPrivateKey {
+		fmt.Printf("  signature:       (public key only, verify only)\n")
+	} else if err != nil {
+		fail(err)
+	} else {
+		fmt.Printf("  signature:       %s\n", signature)
+	}
+
+	ok := false
+	if expected != "" {
+		ok = signer.Verify(stringToSign, expected)
+		if ok {
+			com.ColorLog("[SUCC] verify:         matches # %s #\n", expected)
+		} else {
+			com.ColorLog("[ERRO] verify:         does not match [ %s ]\n", expected)
+		}
+	}
+	fmt.Println()
+	return signature, ok
+}
+
+// loadArguments 合并query字符串、命令行key=value参数和json文件，json与其他参数同名时报错
+func loadArguments() (interface{}, error) {
+	values := url.Values{}
+	if *query != "" {
+		q, err := url.ParseQuery(strings.TrimPrefix(*query, "?"))
+		if err != nil {
+			return nil, err
+		}
+		for k, vs := range q {
+			values[k] = append(values[k], vs...)
+		}
+	}
+	for _, arg := range flag.Args() {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid parameter %q, want key=value", arg)
+		}
+		values.Add(kv[0], kv[1])
+	}
+	if *stamp {
+		values.Set(sign.TimestampKey, strconv.FormatInt(time.Now().Unix(), 10))
+		values.Set(sign.NonceKey, sign.NewNonce())
+	}
+
+	if *jsonFile == "" {
+		return values, nil
+	}
+	var content []byte
+	var err error
+	if *jsonFile == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(*jsonFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 与ginsign中间件一致，数字保持原文
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	arguments := make(map[string]interface{})
+	if err := decoder.Decode(&arguments); err != nil {
+		return nil, err
+	}
+	return sign.MergeValues(arguments, values)
+}
+
+func lookup(arguments interface{}, key string) string {
+	switch val := arguments.(type) {
+	case url.Values:
+		return val.Get(key)
+	case map[string]interface{}:
+		return sign.String(val[key])
+	}
+	return ""
+}
+
+func fail(err error) {
+	com.ColorLog("[ERRO] %s\n", err)
+	os.Exit(2)
+}
@@ -0,0 +1,40 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+)
+
+type ed25519Signer struct {
+	priv ed25519.PrivateKey
+	pub  ed25519.PublicKey
+}
+
+// NewEd25519Signer Ed25519签名，base64编码，可签名和校验
+func NewEd25519Signer(priv ed25519.PrivateKey) Signer {
+	return &ed25519Signer{priv: priv, pub: priv.Public().(ed25519.PublicKey)}
+}
+
+// NewEd25519Verifier 只持有公钥，仅用于校验
+func NewEd25519Verifier(pub ed25519.PublicKey) Signer {
+	return &ed25519Signer{pub: pub}
+}
+
+func (s *ed25519Signer) Alg() string {
+	return AlgEd25519
+}
+
+func (s *ed25519Signer) Sign(data string) (string, error) {
+	if s.priv == nil {
+		return "", ErrNoPrivateKey
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.priv, []byte(data))), nil
+}
+
+func (s *ed25519Signer) Verify(data, sign string) bool {
+	sig, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil || len(s.pub) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(s.pub, []byte(data), sig)
+}
@@ -1,4 +1,4 @@
-package main
+package sign
 
 import (
 	"crypto/hmac"
@@ -6,26 +6,18 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/hex"
-	"fmt"
 	"net/url"
 	"sort"
 	"strings"
 )
 
-func main() {
-	var p url.Values
-	p = make(map[string][]string, 0)
-	p["cc"] = []string{"333"}
-	p["www"] = []string{"34444"}
-	p["aaa"] = []string{"33222"}
-	p["sign"] = []string{"wefwef"}
-	sign := getSign(p, "aaaaa", "sign")
-	fmt.Println(sign)
+// GetSign 排序拼接参数后追加AppSecret，大写md5后再做HMAC-SHA1(base64)
+func GetSign(params url.Values, secret string, filter string) string {
+	encode := EncodeQuery(params, filter)
+	return md5HMACSHA1(encode, secret)
 }
 
-func getSign(params url.Values, secret string, filter string) string {
-	encode := EncodeQuery(params, filter)
-	fmt.Println(encode)
+func md5HMACSHA1(encode, secret string) string {
 	encode += "&AppSecret=" + secret
 	encodeMD5 := strings.ToUpper(EncodeMD5(encode))
 	hmacsha1 := HMACSHA1(secret, encodeMD5)
@@ -0,0 +1,297 @@
+// Package ginsign
+// gin签名校验中间件：收集参数、查找应用密钥并校验签名
+package ginsign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"com/sign"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Source 参与签名的参数来源
+type Source uint8
+
+const (
+	SourceQuery Source = 1 << iota
+	SourceForm
+	SourceJSON
+
+	SourceAll = SourceQuery | SourceForm | SourceJSON
+)
+
+const (
+	// DefaultAppKeyParam 默认的应用标识参数名
+	DefaultAppKeyParam = sign.AppKeyKey
+	// ContextAppKey 校验通过后写入gin.Context的appKey
+	ContextAppKey = "sign.app_key"
+
+	defaultMaxBodySize   = 10 << 20
+	defaultMaxMemorySize = 32 << 20
+)
+
+// 错误码
+const (
+	CodeMissingAppKey = 40001 + iota
+	CodeUnknownApp
+	CodeMissingSign
+	CodeSignMismatch
+	CodeInvalidTimestamp
+	CodeNonceReused
+	CodeInvalidBody
+	CodeAppDisabled
+	CodeIPNotAllowed
+	CodeInternal = 50001
+)
+
+var ErrUnknownApp = sign.ErrUnknownApp
+
+// AppRegistry 根据appKey和来源IP查找应用的Signer，应用不存在时返回ErrUnknownApp，
+// *sign.Registry实现了该接口
+type AppRegistry interface {
+	Lookup(ctx context.Context, appKey, clientIP string) (sign.Signer, error)
+}
+
+// AppRegistryFunc 函数形式的AppRegistry
+type AppRegistryFunc func(ctx context.Context, appKey, clientIP string) (sign.Signer, error)
+
+func (f AppRegistryFunc) Lookup(ctx context.Context, appKey, clientIP string) (sign.Signer, error) {
+	return f(ctx, appKey, clientIP)
+}
+
+// ClientIPFunc 取用于IP白名单的来源IP
+type ClientIPFunc func(c *gin.Context) string
+
+// RemoteIP 默认的ClientIPFunc，取TCP连接的对端地址，不信任任何转发头
+func RemoteIP(c *gin.Context) string {
+	return c.RemoteIP()
+}
+
+// Config 中间件配置
+type Config struct {
+	// Registry 应用注册表，必填
+	Registry AppRegistry
+	// Sources 参数来源，默认SourceAll
+	Sources Source
+	// AppKeyParam 应用标识参数名，默认DefaultAppKeyParam
+	AppKeyParam string
+	// Replay 非空时额外校验timestamp和nonce
+	Replay *sign.ReplayVerifier
+	// Debug 签名不匹配时在响应中返回服务端的待签名串，仅用于联调
+	Debug bool
+	// MaxBodySize 读取body的上限，默认10M
+	MaxBodySize int64
+	// ClientIP 取来源IP，默认RemoteIP；部署在代理后需使用c.ClientIP时，
+	// 必须先用engine.SetTrustedProxies设置可信代理，否则X-Forwarded-For可被客户端伪造
+	ClientIP ClientIPFunc
+}
+
+// ErrorResponse 校验失败时的响应体
+type ErrorResponse struct {
+	Code         int    `json:"code"`
+	Msg          string `json:"msg"`
+	StringToSign string `json:"string_to_sign,omitempty"`
+}
+
+// Middleware 返回签名校验中间件，body读取后会还原，下游handler可正常绑定
+func Middleware(conf Config) gin.HandlerFunc {
+	if conf.Sources == 0 {
+		conf.Sources = SourceAll
+	}
+	if conf.AppKeyParam == "" {
+		conf.AppKeyParam = DefaultAppKeyParam
+	}
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = defaultMaxBodySize
+	}
+	if conf.ClientIP == nil {
+		conf.ClientIP = RemoteIP
+	}
+
+	return func(c *gin.Context) {
+		arguments, err := collectArguments(c.Request, conf.Sources, conf.MaxBodySize)
+		if err != nil {
+			abort(c, http.StatusBadRequest, CodeInvalidBody, err.Error(), "")
+			return
+		}
+
+		appKey := lookup(arguments, conf.AppKeyParam)
+		if appKey == "" {
+			abort(c, http.StatusUnauthorized, CodeMissingAppKey, "missing "+conf.AppKeyParam, "")
+			return
+		}
+		signer, err := conf.Registry.Lookup(c.Request.Context(), appKey, conf.ClientIP(c))
+		if err != nil {
+			status, code := lookupErrorCode(err)
+			abort(c, status, code, err.Error(), "")
+			return
+		}
+
+		if conf.Replay != nil {
+			err = conf.Replay.Verify(c.Request.Context(), signer, arguments)
+		} else if lookup(arguments, sign.SignKey) == "" {
+			err = sign.ErrMissingSign
+		} else if !sign.VerifyWith(signer, lookup(arguments, sign.SignKey), arguments) {
+			err = sign.ErrSignMismatch
+		}
+		if err != nil {
+			status, code := errorCode(err)
+			var stringToSign string
+			if conf.Debug && code == CodeSignMismatch {
+				stringToSign = sign.StringToSign(arguments)
+			}
+			abort(c, status, code, err.Error(), stringToSign)
+			return
+		}
+
+		c.Set(ContextAppKey, appKey)
+		c.Next()
+	}
+}
+
+// RequestMiddleware 校验SigV4风格的请求签名，见sign.RequestVerifier
+// clientIP -- 取来源IP，为nil时使用RemoteIP，见Config.ClientIP
+func RequestMiddleware(verifier *sign.RequestVerifier, clientIP ClientIPFunc) gin.HandlerFunc {
+	if clientIP == nil {
+		clientIP = RemoteIP
+	}
+
+	return func(c *gin.Context) {
+		appKey, err := verifier.Verify(c.Request.Context(), c.Request, clientIP(c))
+		if err != nil {
+			status, code := errorCode(err)
+			if code == CodeInternal {
+				status, code = lookupErrorCode(err)
+			}
+			abort(c, status, code, err.Error(), "")
+			return
+		}
+
+		c.Set(ContextAppKey, appKey)
+		c.Next()
+	}
+}
+
+func errorCode(err error) (int, int) {
+	switch err {
+	case sign.ErrMissingSign, sign.ErrMissingAuthorization, sign.ErrInvalidAuthorization, sign.ErrInvalidScope:
+		return http.StatusUnauthorized, CodeMissingSign
+	case sign.ErrSignMismatch, sign.ErrPayloadMismatch:
+		return http.StatusUnauthorized, CodeSignMismatch
+	case sign.ErrMissingTimestamp, sign.ErrInvalidTimestamp, sign.ErrTimestampSkew, sign.ErrMissingNonce:
+		return http.StatusUnauthorized, CodeInvalidTimestamp
+	case sign.ErrNonceReused:
+		return http.StatusUnauthorized, CodeNonceReused
+	case sign.ErrBodyTooLarge:
+		return http.StatusBadRequest, CodeInvalidBody
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+func lookupErrorCode(err error) (int, int) {
+	switch {
+	case errors.Is(err, sign.ErrUnknownApp):
+		return http.StatusUnauthorized, CodeUnknownApp
+	case errors.Is(err, sign.ErrAppDisabled), errors.Is(err, sign.ErrAppExpired), errors.Is(err, sign.ErrNoActiveSecret):
+		return http.StatusForbidden, CodeAppDisabled
+	case errors.Is(err, sign.ErrIPNotAllowed):
+		return http.StatusForbidden, CodeIPNotAllowed
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+func abort(c *gin.Context, status, code int, msg, stringToSign string) {
+	c.AbortWithStatusJSON(status, ErrorResponse{
+		Code:         code,
+		Msg:          msg,
+		StringToSign: stringToSign,
+	})
+}
+
+// collectArguments 按sources收集参数
+// 只有query、form参数时返回url.Values，同名多值按k=v1&k=v2拼接；
+// 包含json body时合并为map[string]interface{}，单值为string，多值为[]string，
+// query与json同名时返回sign.ErrDuplicateParam；
+// 非空body的Content-Type不在sources中时返回sign.ErrUnsupportedBody，
+// 否则handler用ShouldBindJSON等忽略Content-Type的方法会绑定未签名的body
+func collectArguments(r *http.Request, sources Source, maxBodySize int64) (interface{}, error) {
+	values := url.Values{}
+	if sources&SourceQuery != 0 {
+		for k, vs := range r.URL.Query() {
+			values[k] = append(values[k], vs...)
+		}
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return values, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBodySize {
+		return nil, errors.New("request body too large")
+	}
+	restoreBody(r, body)
+	if len(bytes.TrimSpace(body)) == 0 {
+		return values, nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case sources&SourceForm != 0 && contentType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, vs := range form {
+			values[k] = append(values[k], vs...)
+		}
+	case sources&SourceForm != 0 && contentType == "multipart/form-data":
+		if err := r.ParseMultipartForm(defaultMaxMemorySize); err != nil {
+			return nil, err
+		}
+		restoreBody(r, body)
+		for k, vs := range r.MultipartForm.Value {
+			values[k] = append(values[k], vs...)
+		}
+	case sources&SourceJSON != 0 && contentType == "application/json":
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		arguments := make(map[string]interface{})
+		if err := decoder.Decode(&arguments); err != nil {
+			return nil, err
+		}
+		return sign.MergeValues(arguments, values)
+	default:
+		return nil, sign.ErrUnsupportedBody
+	}
+	return values, nil
+}
+
+func restoreBody(r *http.Request, body []byte) {
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+}
+
+func lookup(arguments interface{}, key string) string {
+	switch val := arguments.(type) {
+	case url.Values:
+		return val.Get(key)
+	case map[string]interface{}:
+		return sign.String(val[key])
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package ginsign
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"com/sign"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testSecret = "secret"
+
+type payment struct {
+	AppKey string `json:"app_key" form:"app_key"`
+	Amount int    `json:"amount" form:"amount"`
+}
+
+func newTestEngine(sources Source) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(Config{
+		Registry: AppRegistryFunc(func(ctx context.Context, appKey, clientIP string) (sign.Signer, error) {
+			if appKey != "app1" {
+				return nil, sign.ErrUnknownApp
+			}
+			return sign.NewMD5Signer(testSecret), nil
+		}),
+		Sources: sources,
+	}))
+	r.POST("/pay", func(c *gin.Context) {
+		var p payment
+		if err := c.ShouldBind(&p); err != nil {
+			c.String(http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	})
+	return r
+}
+
+func serve(r *gin.Engine, query url.Values, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/pay?"+query.Encode(), strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func signedQuery(arguments map[string]interface{}) url.Values {
+	query := url.Values{"app_key": {"app1"}}
+	arguments["app_key"] = "app1"
+	query.Set(sign.SignKey, sign.Create(testSecret, arguments))
+	return query
+}
+
+func errorResponse(t *testing.T, w *httptest.ResponseRecorder) ErrorResponse {
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+// query已签名时，body不能绕过签名被handler绑定
+func TestUnsignedBodyRejected(t *testing.T) {
+	query := signedQuery(map[string]interface{}{})
+	tests := []struct {
+		sources     Source
+		contentType string
+	}{
+		{SourceAll, "text/plain"},
+		{SourceAll, ""},
+		{SourceAll, "application/vnd.api+json"},
+		{SourceQuery, "application/json"},
+		{SourceQuery | SourceJSON, "application/x-www-form-urlencoded"},
+	}
+	for _, tt := range tests {
+		w := serve(newTestEngine(tt.sources), query, tt.contentType, `{"amount":999999}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("sources=%d content type %q: status = %d, body = %s", tt.sources, tt.contentType, w.Code, w.Body)
+			continue
+		}
+		if resp := errorResponse(t, w); resp.Code != CodeInvalidBody || resp.Msg != sign.ErrUnsupportedBody.Error() {
+			t.Errorf("sources=%d content type %q: response = %+v", tt.sources, tt.contentType, resp)
+		}
+	}
+}
+
+// 空body不限制Content-Type
+func TestEmptyBody(t *testing.T) {
+	w := serve(newTestEngine(SourceAll), signedQuery(map[string]interface{}{}), "text/plain", " \n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+}
+
+// 校验后body还原，handler可正常绑定
+func TestBodyRestored(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"app_key":"app1","amount":100}`},
+		{"application/json; charset=utf-8", `{"app_key":"app1","amount":100}`},
+		{"application/x-www-form-urlencoded", "app_key=app1&amount=100"},
+	}
+	for _, tt := range tests {
+		query := url.Values{sign.SignKey: {sign.Create(testSecret, map[string]interface{}{"app_key": "app1", "amount": 100})}}
+		if strings.HasPrefix(tt.contentType, "application/x-www-form-urlencoded") {
+			query.Set(sign.SignKey, sign.Create(testSecret, url.Values{"app_key": {"app1"}, "amount": {"100"}}))
+		}
+
+		w := serve(newTestEngine(SourceAll), query, tt.contentType, tt.body)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, body = %s", tt.contentType, w.Code, w.Body)
+			continue
+		}
+		var p payment
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Amount != 100 {
+			t.Errorf("%s: amount = %d, want 100", tt.contentType, p.Amount)
+		}
+	}
+}
+
+func TestBodyTampered(t *testing.T) {
+	query := url.Values{sign.SignKey: {sign.Create(testSecret, map[string]interface{}{"app_key": "app1", "amount": 100})}}
+	w := serve(newTestEngine(SourceAll), query, "application/json", `{"app_key":"app1","amount":999999}`)
+	if w.Code != http.StatusUnauthorized || errorResponse(t, w).Code != CodeSignMismatch {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+}
+
+// query与json body同名参数，query中未签名的值不能被handler读取
+func TestDuplicateParam(t *testing.T) {
+	query := signedQuery(map[string]interface{}{"amount": "1"})
+	query.Set("amount", "9999")
+	w := serve(newTestEngine(SourceAll), query, "application/json", `{"app_key":"app1","amount":"1"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	if resp := errorResponse(t, w); resp.Code != CodeInvalidBody || resp.Msg != sign.ErrDuplicateParam.Error() {
+		t.Fatalf("response = %+v", resp)
+	}
+}
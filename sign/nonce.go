@@ -0,0 +1,76 @@
+package sign
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NonceStore 记录已使用的nonce
+type NonceStore interface {
+	// Remember 记录nonce并保留ttl，ttl内已存在时返回false
+	Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// RedisNonceStore 基于SET NX EX的nonce存储，多实例共享
+type RedisNonceStore struct {
+	store  *redis.Client
+	prefix string
+}
+
+// NewRedisNonceStore 初始函数
+// prefix -- redis key前缀，区分不同业务
+func NewRedisNonceStore(store *redis.Client, prefix string) *RedisNonceStore {
+	return &RedisNonceStore{
+		store:  store,
+		prefix: prefix,
+	}
+}
+
+func (s *RedisNonceStore) Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.store.SetNX(ctx, s.prefix+nonce, 1, ttl).Result()
+}
+
+// MemoryNonceStore 进程内nonce存储，仅适用于单实例部署
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	nextSweep time.Time
+	nowFunc   func() time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		nonces:  make(map[string]time.Time),
+		nowFunc: time.Now,
+	}
+}
+
+func (s *MemoryNonceStore) Remember(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	now := s.nowFunc()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, ttl)
+	if expireAt, ok := s.nonces[nonce]; ok && now.Before(expireAt) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// sweep 每隔一个ttl清理一次过期nonce
+func (s *MemoryNonceStore) sweep(now time.Time, interval time.Duration) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for k, expireAt := range s.nonces {
+		if !now.Before(expireAt) {
+			delete(s.nonces, k)
+		}
+	}
+	s.nextSweep = now.Add(interval)
+}
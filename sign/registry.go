@@ -0,0 +1,201 @@
+package sign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownApp      = errors.New("sign: unknown app")
+	ErrAppDisabled     = errors.New("sign: app disabled")
+	ErrAppExpired      = errors.New("sign: app expired")
+	ErrNoActiveSecret  = errors.New("sign: no active secret")
+	ErrIPNotAllowed    = errors.New("sign: ip not allowed")
+	ErrUnsupportedAlg  = errors.New("sign: unsupported algorithm")
+	ErrInvalidKeyBytes = errors.New("sign: invalid ed25519 key")
+)
+
+// App 应用配置
+type App struct {
+	AppKey string `json:"app_key"`
+	// Secrets 按新到旧排列，轮换期间新旧密钥同时有效
+	Secrets []Secret `json:"secrets"`
+	// Alg 允许的签名算法，默认AlgMD5
+	Alg string `json:"alg"`
+	// AllowedIPs IP或CIDR白名单，为空不限制
+	AllowedIPs []string `json:"allowed_ips"`
+	Enabled    bool     `json:"enabled"`
+	// ExpireAt 应用过期时间(unix秒)，0为永久
+	ExpireAt int64 `json:"expire_at"`
+}
+
+// Secret 应用密钥
+// 对rsa-sha256为PEM公钥或私钥，对ed25519为base64编码的公钥或私钥
+type Secret struct {
+	Value string `json:"value"`
+	// ExpireAt 密钥失效时间(unix秒)，0为永久，轮换时旧密钥设置为宽限期结束时间
+	ExpireAt int64 `json:"expire_at"`
+}
+
+// Check 校验应用状态和来源IP
+func (a *App) Check(now time.Time, clientIP string) error {
+	if !a.Enabled {
+		return ErrAppDisabled
+	}
+	if a.ExpireAt > 0 && now.Unix() >= a.ExpireAt {
+		return ErrAppExpired
+	}
+	if len(a.AllowedIPs) > 0 && !ipAllowed(a.AllowedIPs, clientIP) {
+		return ErrIPNotAllowed
+	}
+	return nil
+}
+
+// Signer 使用当前有效的全部密钥构造Signer，签名用最新密钥，校验时任一密钥通过即可
+func (a *App) Signer(now time.Time) (Signer, error) {
+	var signers []Signer
+	for _, secret := range a.Secrets {
+		if secret.ExpireAt > 0 && now.Unix() >= secret.ExpireAt {
+			continue
+		}
+		signer, err := NewSigner(a.Alg, secret.Value)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return nil, ErrNoActiveSecret
+	}
+	if len(signers) == 1 {
+		return signers[0], nil
+	}
+	return &multiSigner{signers: signers}, nil
+}
+
+// Rotate 启用新密钥，现有密钥在grace后失效，已失效的密钥被移除
+func (a *App) Rotate(secret string, grace time.Duration, now time.Time) {
+	deadline := now.Add(grace).Unix()
+	secrets := []Secret{{Value: secret}}
+	for _, s := range a.Secrets {
+		if s.ExpireAt > 0 && now.Unix() >= s.ExpireAt {
+			continue
+		}
+		if s.ExpireAt == 0 || s.ExpireAt > deadline {
+			s.ExpireAt = deadline
+		}
+		secrets = append(secrets, s)
+	}
+	a.Secrets = secrets
+}
+
+// NewSigner 按算法名称和密钥构造Signer
+func NewSigner(alg, secret string) (Signer, error) {
+	switch alg {
+	case "", AlgMD5:
+		return NewMD5Signer(secret), nil
+	case AlgMD5HMACSHA1:
+		return NewMD5HMACSHA1Signer(secret), nil
+	case AlgHMACSHA256:
+		return NewHMACSHA256Signer(secret), nil
+	case AlgRSASHA256:
+		if priv, err := ParseRSAPrivateKey([]byte(secret)); err == nil {
+			return NewRSASHA256Signer(priv), nil
+		}
+		pub, err := ParseRSAPublicKey([]byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		return NewRSASHA256Verifier(pub), nil
+	case AlgEd25519:
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secret))
+		if err != nil {
+			return nil, err
+		}
+		switch len(key) {
+		case ed25519.PrivateKeySize:
+			return NewEd25519Signer(ed25519.PrivateKey(key)), nil
+		case ed25519.PublicKeySize:
+			return NewEd25519Verifier(ed25519.PublicKey(key)), nil
+		}
+		return nil, ErrInvalidKeyBytes
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+}
+
+func ipAllowed(allowed []string, clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, item := range allowed {
+		if strings.Contains(item, "/") {
+			if _, ipNet, err := net.ParseCIDR(item); err == nil && ipNet.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(item); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type multiSigner struct {
+	signers []Signer
+}
+
+func (m *multiSigner) Alg() string {
+	return m.signers[0].Alg()
+}
+
+func (m *multiSigner) Sign(data string) (string, error) {
+	return m.signers[0].Sign(data)
+}
+
+// Verify 逐个密钥校验，不提前返回，避免通过耗时判断命中的密钥
+func (m *multiSigner) Verify(data, sign string) bool {
+	ok := false
+	for _, signer := range m.signers {
+		if signer.Verify(data, sign) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// AppStore 应用配置存储，应用不存在时返回ErrUnknownApp
+type AppStore interface {
+	Get(ctx context.Context, appKey string) (*App, error)
+}
+
+// Registry 按appKey查找应用，校验状态后返回其Signer
+type Registry struct {
+	store   AppStore
+	nowFunc func() time.Time
+}
+
+func NewRegistry(store AppStore) *Registry {
+	return &Registry{
+		store:   store,
+		nowFunc: time.Now,
+	}
+}
+
+// Lookup 查找应用并校验启用状态、有效期和来源IP
+func (r *Registry) Lookup(ctx context.Context, appKey, clientIP string) (Signer, error) {
+	app, err := r.store.Get(ctx, appKey)
+	if err != nil {
+		return nil, err
+	}
+	now := r.nowFunc()
+	if err := app.Check(now, clientIP); err != nil {
+		return nil, err
+	}
+	return app.Signer(now)
+}
@@ -0,0 +1,151 @@
+package sign
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	TimestampKey = "timestamp"
+	NonceKey     = "nonce"
+
+	// DefaultSkew 默认允许的客户端与服务端时间偏差
+	DefaultSkew = 5 * time.Minute
+)
+
+var (
+	ErrMissingSign      = errors.New("sign: missing sign")
+	ErrMissingTimestamp = errors.New("sign: missing timestamp")
+	ErrInvalidTimestamp = errors.New("sign: invalid timestamp")
+	ErrTimestampSkew    = errors.New("sign: timestamp out of allowed skew")
+	ErrMissingNonce     = errors.New("sign: missing nonce")
+	ErrNonceReused      = errors.New("sign: nonce reused")
+	ErrSignMismatch     = errors.New("sign: signature mismatch")
+)
+
+// ReplayVerifier 在签名校验之外要求timestamp和nonce参数，
+// timestamp须在skew窗口内，nonce在窗口内只能使用一次
+type ReplayVerifier struct {
+	store   NonceStore
+	skew    time.Duration
+	nowFunc func() time.Time
+}
+
+// NewReplayVerifier 初始函数
+// skew -- 允许的时间偏差，<=0时使用DefaultSkew
+func NewReplayVerifier(store NonceStore, skew time.Duration) *ReplayVerifier {
+	if skew <= 0 {
+		skew = DefaultSkew
+	}
+	return &ReplayVerifier{
+		store:   store,
+		skew:    skew,
+		nowFunc: time.Now,
+	}
+}
+
+// Verify 依次校验timestamp、签名和nonce，签名通过后才记录nonce，避免伪造请求占用nonce
+func (v *ReplayVerifier) Verify(ctx context.Context, signer Signer, arguments interface{}) error {
+	sign := lookupArgument(arguments, SignKey)
+	if sign == "" {
+		return ErrMissingSign
+	}
+	ts := lookupArgument(arguments, TimestampKey)
+	if ts == "" {
+		return ErrMissingTimestamp
+	}
+	if err := v.checkTimestamp(ts); err != nil {
+		return err
+	}
+	nonce := lookupArgument(arguments, NonceKey)
+	if nonce == "" {
+		return ErrMissingNonce
+	}
+	if !signer.Verify(joinArguments(arguments), sign) {
+		return ErrSignMismatch
+	}
+
+	// timestamp前后各skew都可能被接受，nonce需保留整个窗口
+	ok, err := v.store.Remember(ctx, nonce, 2*v.skew)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNonceReused
+	}
+	return nil
+}
+
+func (v *ReplayVerifier) checkTimestamp(ts string) error {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	delta := v.nowFunc().Sub(time.Unix(sec, 0))
+	if delta > v.skew || delta < -v.skew {
+		return ErrTimestampSkew
+	}
+	return nil
+}
+
+// SignValues 写入timestamp、nonce后对values签名，并将结果写入sign
+func SignValues(signer Signer, values url.Values) error {
+	values.Set(TimestampKey, timestamp())
+	values.Set(NonceKey, NewNonce())
+	values.Del(SignKey)
+	sign, err := signer.Sign(joinArguments(values))
+	if err != nil {
+		return err
+	}
+	values.Set(SignKey, sign)
+	return nil
+}
+
+func timestamp() string {
+	return strconv.FormatInt(time.Now().Unix(), 10)
+}
+
+// NewNonce 生成32位hex随机串
+func NewNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// lookupArgument 从url.Values、map或带json tag的struct中取出参数值
+func lookupArgument(data interface{}, key string) string {
+	switch val := data.(type) {
+	case url.Values:
+		return val.Get(key)
+	case map[string]string:
+		return val[key]
+	}
+
+	rValue := reflect.Indirect(reflect.ValueOf(data))
+	switch rValue.Kind() {
+	case reflect.Map:
+		if rValue.Type().Key().Kind() != reflect.String {
+			return ""
+		}
+		v := rValue.MapIndex(reflect.ValueOf(key).Convert(rValue.Type().Key()))
+		if !v.IsValid() {
+			return ""
+		}
+		return String(v.Interface())
+	case reflect.Struct:
+		for _, f := range structFields(rValue.Type()) {
+			if f.name == key {
+				return String(rValue.FieldByIndex(f.index).Interface())
+			}
+		}
+	}
+	return ""
+}
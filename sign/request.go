@@ -0,0 +1,417 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 参照AWS SigV4的请求签名，覆盖method、path、query、指定header和body摘要
+//
+// CanonicalRequest =
+//   Method + "\n" +
+//   CanonicalURI + "\n" +          // path按段做RFC3986编码，空path为/
+//   CanonicalQueryString + "\n" +  // key、value做RFC3986编码后按key、value排序，以&连接
+//   CanonicalHeaders + "\n" +      // 小写header名:去首尾空白并合并连续空格的值，每行以\n结尾，按名称排序
+//   SignedHeaders + "\n" +         // 参与签名的小写header名，以;连接
+//   HashedPayload                  // hex(sha256(body))
+//
+// StringToSign = RequestAlgorithm + "\n" + X-Com-Date + "\n" + Scope + "\n" + hex(sha256(CanonicalRequest))
+// Scope = yyyymmdd/service/com_request
+// SigningKey = HMAC(HMAC(HMAC("COM"+secret, yyyymmdd), service), "com_request")
+// Signature = hex(HMAC(SigningKey, StringToSign))
+//
+// Authorization: COM-HMAC-SHA256 Credential=appKey/Scope, SignedHeaders=host;x-com-content-sha256;x-com-date, Signature=...
+
+const (
+	// RequestAlgorithm 请求签名算法名，App.Alg需配置为AlgRequestHMACSHA256
+	RequestAlgorithm     = "COM-HMAC-SHA256"
+	AlgRequestHMACSHA256 = "request-hmac-sha256"
+
+	HeaderAuthorization = "Authorization"
+	HeaderDate          = "X-Com-Date"
+	HeaderContentSHA256 = "X-Com-Content-Sha256"
+
+	requestTimeFormat = "20060102T150405Z"
+	requestDateFormat = "20060102"
+	scopeTerminator   = "com_request"
+
+	defaultRequestMaxBodySize = 10 << 20
+)
+
+var (
+	ErrMissingAuthorization = errors.New("sign: missing authorization")
+	ErrInvalidAuthorization = errors.New("sign: invalid authorization")
+	ErrInvalidScope         = errors.New("sign: invalid credential scope")
+	ErrPayloadMismatch      = errors.New("sign: payload hash mismatch")
+	ErrBodyTooLarge         = errors.New("sign: request body too large")
+)
+
+// RequestSigner 客户端请求签名
+type RequestSigner struct {
+	AppKey  string
+	Secret  string
+	Service string
+	// SignedHeaders 除host、x-com-date、x-com-content-sha256外额外参与签名的header
+	SignedHeaders []string
+	nowFunc       func() time.Time
+}
+
+func NewRequestSigner(appKey, secret, service string, signedHeaders ...string) *RequestSigner {
+	return &RequestSigner{
+		AppKey:        appKey,
+		Secret:        secret,
+		Service:       service,
+		SignedHeaders: signedHeaders,
+		nowFunc:       time.Now,
+	}
+}
+
+// Sign 计算签名并写入X-Com-Date、X-Com-Content-Sha256和Authorization，body读取后会还原
+func (s *RequestSigner) Sign(req *http.Request) error {
+	body, err := readBody(req, 0)
+	if err != nil {
+		return err
+	}
+
+	now := s.nowFunc().UTC()
+	req.Header.Set(HeaderDate, now.Format(requestTimeFormat))
+	req.Header.Set(HeaderContentSHA256, hashHex(body))
+
+	signedHeaders := normalizeSignedHeaders(s.SignedHeaders)
+	scope := requestScope(now, s.Service)
+	stringToSign := requestStringToSign(req, signedHeaders, scope, req.Header.Get(HeaderContentSHA256))
+	signature := hex.EncodeToString(hmacSHA256(requestSigningKey(s.Secret, now, s.Service), stringToSign))
+
+	req.Header.Set(HeaderAuthorization, RequestAlgorithm+
+		" Credential="+s.AppKey+"/"+scope+
+		", SignedHeaders="+strings.Join(signedHeaders, ";")+
+		", Signature="+signature)
+	return nil
+}
+
+// Client 返回自动签名的*http.Client，base为空时使用http.DefaultTransport
+func (s *RequestSigner) Client(base http.RoundTripper) *http.Client {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &http.Client{Transport: &requestSignerTransport{signer: s, base: base}}
+}
+
+type requestSignerTransport struct {
+	signer *RequestSigner
+	base   http.RoundTripper
+}
+
+func (t *requestSignerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed := req.Clone(req.Context())
+	if err := t.signer.Sign(signed); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(signed)
+}
+
+// RequestVerifier 服务端请求签名校验，密钥从AppStore读取，轮换期间新旧密钥均可通过
+type RequestVerifier struct {
+	store   AppStore
+	service string
+	skew    time.Duration
+	// MaxBodySize 读取body的上限，默认10M
+	MaxBodySize int64
+	nowFunc     func() time.Time
+}
+
+// NewRequestVerifier 初始函数
+// skew -- 允许的时间偏差，<=0时使用DefaultSkew
+func NewRequestVerifier(store AppStore, service string, skew time.Duration) *RequestVerifier {
+	if skew <= 0 {
+		skew = DefaultSkew
+	}
+	return &RequestVerifier{
+		store:       store,
+		service:     service,
+		skew:        skew,
+		MaxBodySize: defaultRequestMaxBodySize,
+		nowFunc:     time.Now,
+	}
+}
+
+// Verify 校验请求签名，返回appKey，body读取后会还原
+// clientIP -- 用于IP白名单，为空时取RemoteAddr
+func (v *RequestVerifier) Verify(ctx context.Context, req *http.Request, clientIP string) (string, error) {
+	auth, err := parseAuthorization(req.Header.Get(HeaderAuthorization))
+	if err != nil {
+		return "", err
+	}
+
+	signedAt, err := time.Parse(requestTimeFormat, req.Header.Get(HeaderDate))
+	if err != nil {
+		return auth.appKey, ErrInvalidTimestamp
+	}
+	if delta := v.nowFunc().Sub(signedAt); delta > v.skew || delta < -v.skew {
+		return auth.appKey, ErrTimestampSkew
+	}
+	if auth.scope != requestScope(signedAt, v.service) {
+		return auth.appKey, ErrInvalidScope
+	}
+
+	body, err := readBody(req, v.MaxBodySize)
+	if err != nil {
+		return auth.appKey, err
+	}
+	payloadHash := hashHex(body)
+	if !equal(payloadHash, req.Header.Get(HeaderContentSHA256)) {
+		return auth.appKey, ErrPayloadMismatch
+	}
+
+	app, err := v.store.Get(ctx, auth.appKey)
+	if err != nil {
+		return auth.appKey, err
+	}
+	now := v.nowFunc()
+	if clientIP == "" {
+		clientIP = remoteIP(req)
+	}
+	if err := app.Check(now, clientIP); err != nil {
+		return auth.appKey, err
+	}
+	if app.Alg != AlgRequestHMACSHA256 {
+		return auth.appKey, ErrUnsupportedAlg
+	}
+
+	stringToSign := requestStringToSign(req, auth.signedHeaders, auth.scope, payloadHash)
+	matched := false
+	for _, secret := range app.Secrets {
+		if secret.ExpireAt > 0 && now.Unix() >= secret.ExpireAt {
+			continue
+		}
+		expected := hex.EncodeToString(hmacSHA256(requestSigningKey(secret.Value, signedAt, v.service), stringToSign))
+		if equal(expected, auth.signature) {
+			matched = true
+		}
+	}
+	if !matched {
+		return auth.appKey, ErrSignMismatch
+	}
+	return auth.appKey, nil
+}
+
+// CanonicalRequest 返回请求的规范串，便于联调比对
+func CanonicalRequest(req *http.Request, signedHeaders []string, payloadHash string) string {
+	return canonicalRequest(req, normalizeSignedHeaders(signedHeaders), payloadHash)
+}
+
+func canonicalRequest(req *http.Request, signedHeaders []string, payloadHash string) string {
+	var buf strings.Builder
+	buf.WriteString(req.Method)
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalURI(req.URL.Path))
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalQuery(req.URL.Query()))
+	buf.WriteByte('\n')
+	for _, name := range signedHeaders {
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(canonicalHeaderValue(req, name))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(strings.Join(signedHeaders, ";"))
+	buf.WriteByte('\n')
+	buf.WriteString(payloadHash)
+	return buf.String()
+}
+
+func requestStringToSign(req *http.Request, signedHeaders []string, scope, payloadHash string) string {
+	return RequestAlgorithm + "\n" +
+		req.Header.Get(HeaderDate) + "\n" +
+		scope + "\n" +
+		hashHex([]byte(canonicalRequest(req, signedHeaders, payloadHash)))
+}
+
+func requestScope(t time.Time, service string) string {
+	return t.UTC().Format(requestDateFormat) + "/" + service + "/" + scopeTerminator
+}
+
+// requestSigningKey 按日期和服务派生签名密钥，泄露的派生密钥只在当天当前服务有效
+func requestSigningKey(secret string, t time.Time, service string) []byte {
+	kDate := hmacSHA256([]byte("COM"+secret), t.UTC().Format(requestDateFormat))
+	kService := hmacSHA256(kDate, service)
+	return hmacSHA256(kService, scopeTerminator)
+}
+
+func normalizeSignedHeaders(extra []string) []string {
+	seen := map[string]bool{"host": true, "x-com-content-sha256": true, "x-com-date": true}
+	headers := []string{"host", "x-com-content-sha256", "x-com-date"}
+	for _, name := range extra {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = uriEncode(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(values url.Values) string {
+	pairs := make([]string, 0, len(values))
+	for k, vs := range values {
+		for _, v := range vs {
+			pairs = append(pairs, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func canonicalHeaderValue(req *http.Request, name string) string {
+	if name == "host" {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+	// com.HttpCall会原样写入非规范化的header名，如content-type
+	var values []string
+	for k, vs := range req.Header {
+		if !strings.EqualFold(k, name) {
+			continue
+		}
+		for _, v := range vs {
+			values = append(values, strings.Join(strings.Fields(v), " "))
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+// uriEncode RFC3986编码，保留A-Za-z0-9-_.~
+func uriEncode(s string) string {
+	const hexChars = "0123456789ABCDEF"
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			buf.WriteByte(c)
+			continue
+		}
+		buf.WriteByte('%')
+		buf.WriteByte(hexChars[c>>4])
+		buf.WriteByte(hexChars[c&15])
+	}
+	return buf.String()
+}
+
+type authorization struct {
+	appKey        string
+	scope         string
+	signedHeaders []string
+	signature     string
+}
+
+func parseAuthorization(header string) (*authorization, error) {
+	if header == "" {
+		return nil, ErrMissingAuthorization
+	}
+	if !strings.HasPrefix(header, RequestAlgorithm+" ") {
+		return nil, ErrInvalidAuthorization
+	}
+	auth := &authorization{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, RequestAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrInvalidAuthorization
+		}
+		switch kv[0] {
+		case "Credential":
+			idx := strings.Index(kv[1], "/")
+			if idx <= 0 {
+				return nil, ErrInvalidAuthorization
+			}
+			auth.appKey, auth.scope = kv[1][:idx], kv[1][idx+1:]
+		case "SignedHeaders":
+			auth.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			auth.signature = kv[1]
+		}
+	}
+	if auth.appKey == "" || auth.signature == "" || len(auth.signedHeaders) == 0 {
+		return nil, ErrInvalidAuthorization
+	}
+	// 必须覆盖的header缺失时视为非法
+	signed := make(map[string]bool, len(auth.signedHeaders))
+	for _, name := range auth.signedHeaders {
+		signed[name] = true
+	}
+	if !signed["host"] || !signed["x-com-date"] || !signed["x-com-content-sha256"] {
+		return nil, ErrInvalidAuthorization
+	}
+	return auth, nil
+}
+
+// readBody 读取并还原body，maxSize<=0时不限制
+func readBody(req *http.Request, maxSize int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	var reader io.Reader = req.Body
+	if maxSize > 0 {
+		reader = io.LimitReader(req.Body, maxSize+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return nil, ErrBodyTooLarge
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,100 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoPrivateKey 只有公钥的Signer不能签名
+	ErrNoPrivateKey = errors.New("sign: private key required")
+	// ErrInvalidPEM PEM解析失败
+	ErrInvalidPEM = errors.New("sign: invalid pem block")
+)
+
+type rsaSHA256Signer struct {
+	priv *rsa.PrivateKey
+	pub  *rsa.PublicKey
+}
+
+// NewRSASHA256Signer RSA PKCS#1 v1.5 + SHA256，base64编码，可签名和校验
+func NewRSASHA256Signer(priv *rsa.PrivateKey) Signer {
+	return &rsaSHA256Signer{priv: priv, pub: &priv.PublicKey}
+}
+
+// NewRSASHA256Verifier 只持有公钥，仅用于校验
+func NewRSASHA256Verifier(pub *rsa.PublicKey) Signer {
+	return &rsaSHA256Signer{pub: pub}
+}
+
+func (s *rsaSHA256Signer) Alg() string {
+	return AlgRSASHA256
+}
+
+func (s *rsaSHA256Signer) Sign(data string) (string, error) {
+	if s.priv == nil {
+		return "", ErrNoPrivateKey
+	}
+	digest := sha256.Sum256([]byte(data))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.priv, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (s *rsaSHA256Signer) Verify(data, sign string) bool {
+	sig, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256([]byte(data))
+	return rsa.VerifyPKCS1v15(s.pub, crypto.SHA256, digest[:], sig) == nil
+}
+
+// ParseRSAPrivateKey 解析PKCS#1或PKCS#8格式的PEM私钥
+func ParseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("sign: not a rsa private key: %T", key)
+	}
+	return rsaKey, nil
+}
+
+// ParseRSAPublicKey 解析PKIX或PKCS#1格式的PEM公钥
+func ParseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("sign: not a rsa public key: %T", key)
+	}
+	return rsaKey, nil
+}
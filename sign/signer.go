@@ -0,0 +1,105 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// 签名算法名称
+const (
+	AlgMD5         = "md5"
+	AlgMD5HMACSHA1 = "md5-hmac-sha1"
+	AlgHMACSHA256  = "hmac-sha256"
+	AlgRSASHA256   = "rsa-sha256"
+	AlgEd25519     = "ed25519"
+)
+
+// Signer 对排序拼接后的参数串计算和校验签名
+type Signer interface {
+	// Alg 返回算法名称
+	Alg() string
+	// Sign 计算data的签名
+	Sign(data string) (string, error)
+	// Verify 校验data的签名，比较过程为常量时间
+	Verify(data, sign string) bool
+}
+
+// equal 常量时间比较，避免时序攻击
+func equal(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
+
+type md5Signer struct {
+	salt string
+}
+
+// NewMD5Signer md5(参数串+salt)，hex编码
+func NewMD5Signer(salt string) Signer {
+	return &md5Signer{salt: salt}
+}
+
+func (s *md5Signer) Alg() string {
+	return AlgMD5
+}
+
+func (s *md5Signer) Sign(data string) (string, error) {
+	h := md5.New()
+	h.Write([]byte(data + s.salt))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *md5Signer) Verify(data, sign string) bool {
+	expected, _ := s.Sign(data)
+	return equal(expected, sign)
+}
+
+type md5HMACSHA1Signer struct {
+	secret string
+}
+
+// NewMD5HMACSHA1Signer 参数串追加&AppSecret=secret后取大写md5，再以secret做HMAC-SHA1，base64编码，同GetSign
+func NewMD5HMACSHA1Signer(secret string) Signer {
+	return &md5HMACSHA1Signer{secret: secret}
+}
+
+func (s *md5HMACSHA1Signer) Alg() string {
+	return AlgMD5HMACSHA1
+}
+
+func (s *md5HMACSHA1Signer) Sign(data string) (string, error) {
+	return md5HMACSHA1(data, s.secret), nil
+}
+
+func (s *md5HMACSHA1Signer) Verify(data, sign string) bool {
+	return equal(md5HMACSHA1(data, s.secret), sign)
+}
+
+type hmacSHA256Signer struct {
+	secret []byte
+}
+
+// NewHMACSHA256Signer HMAC-SHA256(secret, 参数串)，hex编码
+func NewHMACSHA256Signer(secret string) Signer {
+	return &hmacSHA256Signer{secret: []byte(secret)}
+}
+
+func (s *hmacSHA256Signer) Alg() string {
+	return AlgHMACSHA256
+}
+
+func (s *hmacSHA256Signer) Sign(data string) (string, error) {
+	return HMACSHA256(s.secret, data), nil
+}
+
+func (s *hmacSHA256Signer) Verify(data, sign string) bool {
+	return equal(HMACSHA256(s.secret, data), sign)
+}
+
+// HMACSHA256 hex编码的HMAC-SHA256
+func HMACSHA256(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
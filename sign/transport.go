@@ -0,0 +1,133 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Transport 对外发请求自动签名的http.RoundTripper
+// app_key、timestamp、nonce和sign写入query，参与签名的参数为query加上
+// form body或json body的顶层字段，与ginsign.Middleware的收集规则一致，
+// 其他Content-Type的非空body无法签名，返回ErrUnsupportedBody
+type Transport struct {
+	// Signer 签名算法，必填
+	Signer Signer
+	// AppKey 分配给我方的应用标识
+	AppKey string
+	// AppKeyParam 应用标识参数名，默认AppKeyKey
+	AppKeyParam string
+	// Base 实际发送请求的RoundTripper，默认http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// NewTransport 初始函数
+func NewTransport(signer Signer, appKey string) *Transport {
+	return &Transport{
+		Signer: signer,
+		AppKey: appKey,
+	}
+}
+
+// NewClient 返回自动签名的*http.Client，可直接用于com.HttpGet、com.HttpPost、com.HttpPostJSON
+func NewClient(signer Signer, appKey string) *http.Client {
+	return &http.Client{Transport: NewTransport(signer, appKey)}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip不能修改原请求
+	signed := req.Clone(req.Context())
+
+	appKeyParam := t.AppKeyParam
+	if appKeyParam == "" {
+		appKeyParam = AppKeyKey
+	}
+	query := signed.URL.Query()
+	query.Del(SignKey)
+	query.Set(appKeyParam, t.AppKey)
+	query.Set(TimestampKey, timestamp())
+	query.Set(NonceKey, NewNonce())
+
+	var arguments interface{} = query
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+		signed.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		signed.ContentLength = int64(len(body))
+
+		arguments, err = bodyArguments(signed.Header, body, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sign, err := t.Signer.Sign(joinArguments(arguments))
+	if err != nil {
+		return nil, err
+	}
+	query.Set(SignKey, sign)
+	signed.URL.RawQuery = query.Encode()
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
+
+// bodyArguments 合并query和body参数，非空body不是form、json时返回ErrUnsupportedBody
+func bodyArguments(header http.Header, body []byte, query url.Values) (interface{}, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return query, nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(headerValue(header, "Content-Type"))
+	switch contentType {
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		values := url.Values{}
+		for k, vs := range query {
+			values[k] = append(values[k], vs...)
+		}
+		for k, vs := range form {
+			values[k] = append(values[k], vs...)
+		}
+		return values, nil
+	case "application/json":
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		arguments := make(map[string]interface{})
+		if err := decoder.Decode(&arguments); err != nil {
+			return nil, err
+		}
+		return MergeValues(arguments, query)
+	}
+	return nil, ErrUnsupportedBody
+}
+
+// headerValue 忽略大小写取header，com.HttpPostJSON写入的是非规范化的content-type
+func headerValue(header http.Header, key string) string {
+	if v := header.Get(key); v != "" {
+		return v
+	}
+	for k, vs := range header {
+		if strings.EqualFold(k, key) && len(vs) > 0 {
+			return vs[0]
+		}
+	}
+	return ""
+}
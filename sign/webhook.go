@@ -0,0 +1,334 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"com"
+)
+
+// 回调签名，格式同Stripe：
+//   Signature: t=1700000000,v1=<hex>,v1=<hex>
+// v1 = hex(HMAC-SHA256(secret, t + "." + body))，密钥轮换期间每个有效密钥各输出一个v1
+
+const (
+	WebhookSignatureHeader = "Signature"
+	WebhookIDHeader        = "Webhook-Id"
+	webhookScheme          = "v1"
+
+	// DefaultWebhookTolerance 接收方默认允许的时间偏差
+	DefaultWebhookTolerance = 5 * time.Minute
+	// DefaultWebhookMaxAttempts 默认最大投递次数
+	DefaultWebhookMaxAttempts = 8
+)
+
+var (
+	ErrWebhookHeader    = errors.New("sign: invalid webhook signature header")
+	ErrWebhookNoSecret  = errors.New("sign: webhook secret required")
+	ErrWebhookExhausted = errors.New("sign: webhook delivery attempts exhausted")
+)
+
+// SignWebhook 计算回调签名头，secrets按新到旧排列
+func SignWebhook(payload []byte, t time.Time, secrets ...string) (string, error) {
+	if len(secrets) == 0 {
+		return "", ErrWebhookNoSecret
+	}
+	ts := strconv.FormatInt(t.Unix(), 10)
+	signed := webhookSignedPayload(ts, payload)
+
+	var buf strings.Builder
+	buf.WriteString("t=")
+	buf.WriteString(ts)
+	for _, secret := range secrets {
+		buf.WriteString("," + webhookScheme + "=")
+		buf.WriteString(HMACSHA256([]byte(secret), signed))
+	}
+	return buf.String(), nil
+}
+
+// VerifyWebhook 供回调接收方使用，任一密钥与任一v1匹配且时间在tolerance内即通过
+// tolerance<=0时使用DefaultWebhookTolerance
+func VerifyWebhook(payload []byte, header string, tolerance time.Duration, secrets ...string) error {
+	if len(secrets) == 0 {
+		return ErrWebhookNoSecret
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultWebhookTolerance
+	}
+	ts, signatures, err := parseWebhookHeader(header)
+	if err != nil {
+		return err
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if delta := time.Since(time.Unix(sec, 0)); delta > tolerance || delta < -tolerance {
+		return ErrTimestampSkew
+	}
+
+	signed := webhookSignedPayload(ts, payload)
+	matched := false
+	for _, secret := range secrets {
+		expected := HMACSHA256([]byte(secret), signed)
+		for _, sig := range signatures {
+			if equal(expected, sig) {
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		return ErrSignMismatch
+	}
+	return nil
+}
+
+func parseWebhookHeader(header string) (string, []string, error) {
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case webhookScheme:
+			signatures = append(signatures, kv[1])
+		}
+	}
+	if ts == "" || len(signatures) == 0 {
+		return "", nil, ErrWebhookHeader
+	}
+	return ts, signatures, nil
+}
+
+func webhookSignedPayload(ts string, payload []byte) string {
+	return ts + "." + string(payload)
+}
+
+// Delivery 一次回调及其投递记录
+type Delivery struct {
+	ID      string
+	URL     string
+	Payload []byte
+	// Attempts 已投递次数
+	Attempts int
+	// LastError 最近一次失败原因
+	LastError string
+	// LastAttemptAt 最近一次投递时间
+	LastAttemptAt time.Time
+	// NextAttemptAt 下次可投递时间，投递成功或放弃后为零值
+	NextAttemptAt time.Time
+	Delivered     bool
+}
+
+// WebhookSender 签名并通过com.HttpCall投递回调，接收方返回200视为成功
+type WebhookSender struct {
+	client  *http.Client
+	secrets []string
+	// MaxAttempts 最大投递次数，默认DefaultWebhookMaxAttempts
+	MaxAttempts int
+	// Backoff 第attempt次失败后的等待时间，默认指数退避：5s、10s、20s…最长1h
+	Backoff func(attempt int) time.Duration
+	nowFunc func() time.Time
+}
+
+// NewWebhookSender 初始函数，secrets为空时返回ErrWebhookNoSecret
+// secrets -- 按新到旧排列，轮换期间同时传入新旧密钥
+func NewWebhookSender(client *http.Client, secrets ...string) (*WebhookSender, error) {
+	if len(secrets) == 0 {
+		return nil, ErrWebhookNoSecret
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &WebhookSender{
+		client:      client,
+		secrets:     secrets,
+		MaxAttempts: DefaultWebhookMaxAttempts,
+		Backoff:     defaultWebhookBackoff,
+		nowFunc:     time.Now,
+	}, nil
+}
+
+// NewDelivery 生成一次待投递的回调
+func NewDelivery(url string, payload []byte) *Delivery {
+	return &Delivery{
+		ID:      NewNonce(),
+		URL:     url,
+		Payload: payload,
+	}
+}
+
+// Send 投递一次并更新d的投递记录，调用方可将d持久化后按NextAttemptAt重试
+func (s *WebhookSender) Send(ctx context.Context, d *Delivery) error {
+	if d.Delivered {
+		return nil
+	}
+	if d.Attempts >= s.MaxAttempts {
+		return ErrWebhookExhausted
+	}
+
+	now := s.nowFunc()
+	d.Attempts++
+	d.LastAttemptAt = now
+
+	err := s.post(ctx, d, now)
+	if err == nil {
+		d.Delivered = true
+		d.LastError = ""
+		d.NextAttemptAt = time.Time{}
+		return nil
+	}
+
+	d.LastError = err.Error()
+	if d.Attempts >= s.MaxAttempts {
+		d.NextAttemptAt = time.Time{}
+	} else {
+		d.NextAttemptAt = now.Add(s.Backoff(d.Attempts))
+	}
+	return err
+}
+
+// SendWithRetry 在当前goroutine内按退避间隔重试，直至成功、次数用尽或ctx结束
+func (s *WebhookSender) SendWithRetry(ctx context.Context, d *Delivery) error {
+	for {
+		err := s.Send(ctx, d)
+		if err == nil {
+			return nil
+		}
+		if d.NextAttemptAt.IsZero() {
+			return ErrWebhookExhausted
+		}
+
+		timer := time.NewTimer(d.NextAttemptAt.Sub(s.nowFunc()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *WebhookSender) post(ctx context.Context, d *Delivery, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	signature, err := SignWebhook(d.Payload, now, s.secrets...)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(WebhookSignatureHeader, signature)
+	header.Set(WebhookIDHeader, d.ID)
+
+	// com.HttpCall创建的请求不带ctx，由transport附加，ctx无deadline时也能取消
+	client := *s.client
+	client.Transport = contextTransport{ctx: ctx, base: client.Transport}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			// Timeout为负数时http.Client不超时
+			return context.DeadlineExceeded
+		}
+		if client.Timeout == 0 || timeout < client.Timeout {
+			client.Timeout = timeout
+		}
+	}
+	rc, err := com.HttpCall(&client, http.MethodPost, d.URL, header, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	return rc.Close()
+}
+
+// contextTransport 为请求附加ctx
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
+
+func defaultWebhookBackoff(attempt int) time.Duration {
+	backoff := 5 * time.Second
+	for i := 1; i < attempt && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > time.Hour {
+		backoff = time.Hour
+	}
+	return backoff
+}
+
+// ReceivedWebhook WebhookReceiver收到的回调
+type ReceivedWebhook struct {
+	ID       string
+	Payload  []byte
+	Verified bool
+	Err      error
+}
+
+// WebhookReceiver 本地联调用的回调接收端，校验签名并记录收到的回调
+// 校验通过返回200，否则返回400
+type WebhookReceiver struct {
+	secrets   []string
+	tolerance time.Duration
+	mu        sync.Mutex
+	received  []ReceivedWebhook
+}
+
+func NewWebhookReceiver(tolerance time.Duration, secrets ...string) *WebhookReceiver {
+	return &WebhookReceiver{
+		secrets:   secrets,
+		tolerance: tolerance,
+	}
+}
+
+func (r *WebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = VerifyWebhook(payload, req.Header.Get(WebhookSignatureHeader), r.tolerance, r.secrets...)
+
+	r.mu.Lock()
+	r.received = append(r.received, ReceivedWebhook{
+		ID:       req.Header.Get(WebhookIDHeader),
+		Payload:  payload,
+		Verified: err == nil,
+		Err:      err,
+	})
+	r.mu.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Received 返回已收到的回调
+func (r *WebhookReceiver) Received() []ReceivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ReceivedWebhook(nil), r.received...)
+}
@@ -0,0 +1,235 @@
+// Package sketch counts items in fixed memory, like finding hot keys.
+package sketch
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spaolacci/murmur3"
+)
+
+// ErrInvalidSketch indicates the width, depth or error bounds of a sketch are invalid.
+var ErrInvalidSketch = errors.New("invalid count-min sketch")
+
+var (
+	// countMinIncrScript does a conservative update: only the counters below the new
+	// estimate are raised to it. KEYS[1] is a hash of counters, ARGV[1] is the increment,
+	// the others are the counters of the item, returns the new estimate.
+	countMinIncrScript = redis.NewScript(`
+local counters = redis.call("hmget", KEYS[1], unpack(ARGV, 2))
+local estimate
+for _, count in ipairs(counters) do
+	count = tonumber(count) or 0
+	if estimate == nil or count < estimate then
+		estimate = count
+	end
+end
+estimate = estimate + tonumber(ARGV[1])
+for i, count in ipairs(counters) do
+	if (tonumber(count) or 0) < estimate then
+		redis.call("hset", KEYS[1], ARGV[i + 1], estimate)
+	end
+end
+return estimate
+`)
+)
+
+type (
+	// A CountMinSketch estimates how many times items are counted in fixed memory,
+	// the estimate is never lower than the real count.
+	// With width w and depth d, the estimate exceeds the real count by at most
+	// e/w of the total count with probability 1-e^-d.
+	CountMinSketch struct {
+		width uint
+		depth uint
+		store countMinProvider
+	}
+
+	countMinProvider interface {
+		incr(ctx context.Context, counters []uint, n uint64) (uint64, error)
+		count(ctx context.Context, counters []uint) (uint64, error)
+		reset(ctx context.Context) error
+	}
+)
+
+// NewCountMin creates a redis backed CountMinSketch, store is the backed redis,
+// key is the key for the counters, width is how many counters in each of depth rows.
+// Only counted counters are stored, in a hash.
+func NewCountMin(store *redis.Client, key string, width, depth uint) (*CountMinSketch, error) {
+	if width == 0 || depth == 0 {
+		return nil, ErrInvalidSketch
+	}
+
+	return &CountMinSketch{
+		width: width,
+		depth: depth,
+		store: &redisCountMin{
+			store: store,
+			key:   key,
+		},
+	}, nil
+}
+
+// NewLocalCountMin creates an in-process CountMinSketch, see NewCountMin.
+func NewLocalCountMin(width, depth uint) (*CountMinSketch, error) {
+	if width == 0 || depth == 0 {
+		return nil, ErrInvalidSketch
+	}
+
+	return &CountMinSketch{
+		width: width,
+		depth: depth,
+		store: &localCountMin{
+			counters: make([]uint64, width*depth),
+		},
+	}, nil
+}
+
+// EstimateSketch returns the width and depth for estimates within eps of the total count
+// with probability 1-delta: width = e/eps, depth = ln(1/delta).
+func EstimateSketch(eps, delta float64) (width, depth uint, err error) {
+	if eps <= 0 || eps >= 1 || delta <= 0 || delta >= 1 {
+		return 0, 0, ErrInvalidSketch
+	}
+
+	return uint(math.Ceil(math.E / eps)), uint(math.Ceil(math.Log(1 / delta))), nil
+}
+
+// Incr counts data n times, and returns the estimated count of data.
+func (s *CountMinSketch) Incr(data []byte, n uint64) (uint64, error) {
+	return s.IncrCtx(context.Background(), data, n)
+}
+
+// IncrCtx counts data n times with context.
+func (s *CountMinSketch) IncrCtx(ctx context.Context, data []byte, n uint64) (uint64, error) {
+	return s.store.incr(ctx, s.counters(data), n)
+}
+
+// Count returns the estimated count of data.
+func (s *CountMinSketch) Count(data []byte) (uint64, error) {
+	return s.CountCtx(context.Background(), data)
+}
+
+// CountCtx returns the estimated count of data with context.
+func (s *CountMinSketch) CountCtx(ctx context.Context, data []byte) (uint64, error) {
+	return s.store.count(ctx, s.counters(data))
+}
+
+// Reset clears all counts, like at the start of a new time window.
+func (s *CountMinSketch) Reset() error {
+	return s.ResetCtx(context.Background())
+}
+
+// ResetCtx clears all counts with context.
+func (s *CountMinSketch) ResetCtx(ctx context.Context) error {
+	return s.store.reset(ctx)
+}
+
+// counters returns the index of the counter of data in each row.
+func (s *CountMinSketch) counters(data []byte) []uint {
+	h1, h2 := murmur3.Sum128(data)
+	counters := make([]uint, s.depth)
+	for i := range counters {
+		counters[i] = uint(i)*s.width + uint((h1+uint64(i)*h2)%uint64(s.width))
+	}
+
+	return counters
+}
+
+type redisCountMin struct {
+	store *redis.Client
+	key   string
+}
+
+func (r *redisCountMin) incr(ctx context.Context, counters []uint, n uint64) (uint64, error) {
+	args := make([]interface{}, 0, len(counters)+1)
+	args = append(args, strconv.FormatUint(n, 10))
+	for _, counter := range counters {
+		args = append(args, strconv.FormatUint(uint64(counter), 10))
+	}
+
+	return countMinIncrScript.Run(ctx, r.store, []string{r.key}, args...).Uint64()
+}
+
+func (r *redisCountMin) count(ctx context.Context, counters []uint) (uint64, error) {
+	fields := make([]string, len(counters))
+	for i, counter := range counters {
+		fields[i] = strconv.FormatUint(uint64(counter), 10)
+	}
+
+	values, err := r.store.HMGet(ctx, r.key, fields...).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var estimate uint64
+	for i, value := range values {
+		var count uint64
+		if s, ok := value.(string); ok {
+			if count, err = strconv.ParseUint(s, 10, 64); err != nil {
+				return 0, err
+			}
+		}
+		if i == 0 || count < estimate {
+			estimate = count
+		}
+	}
+
+	return estimate, nil
+}
+
+func (r *redisCountMin) reset(ctx context.Context) error {
+	return r.store.Del(ctx, r.key).Err()
+}
+
+type localCountMin struct {
+	lock     sync.RWMutex
+	counters []uint64
+}
+
+func (l *localCountMin) incr(_ context.Context, counters []uint, n uint64) (uint64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	estimate := l.min(counters) + n
+	for _, counter := range counters {
+		if l.counters[counter] < estimate {
+			l.counters[counter] = estimate
+		}
+	}
+
+	return estimate, nil
+}
+
+func (l *localCountMin) count(_ context.Context, counters []uint) (uint64, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.min(counters), nil
+}
+
+func (l *localCountMin) reset(_ context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for i := range l.counters {
+		l.counters[i] = 0
+	}
+
+	return nil
+}
+
+func (l *localCountMin) min(counters []uint) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for _, counter := range counters {
+		if l.counters[counter] < estimate {
+			estimate = l.counters[counter]
+		}
+	}
+
+	return estimate
+}
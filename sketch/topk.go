@@ -0,0 +1,318 @@
+package sketch
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const errorSuffix = ":error"
+
+// ErrInvalidTopK indicates k of a TopK is invalid.
+var ErrInvalidTopK = errors.New("invalid top-k")
+
+var (
+	// topKIncrScript is the Space-Saving update, KEYS[1] is a sorted set of counts,
+	// KEYS[2] is a hash of errors, ARGV are k, item and the increment.
+	// When full, the item with the least count is replaced by the new item, which takes
+	// over its count as the error. Returns the count and error of item.
+	topKIncrScript = redis.NewScript(`
+local k, item, n = tonumber(ARGV[1]), ARGV[2], tonumber(ARGV[3])
+if redis.call("zscore", KEYS[1], item) then
+	local count = redis.call("zincrby", KEYS[1], n, item)
+	return {tonumber(count), tonumber(redis.call("hget", KEYS[2], item) or "0")}
+end
+if redis.call("zcard", KEYS[1]) < k then
+	redis.call("zadd", KEYS[1], n, item)
+	return {n, 0}
+end
+local least = redis.call("zrange", KEYS[1], 0, 0, "withscores")
+local min = tonumber(least[2])
+redis.call("zrem", KEYS[1], least[1])
+redis.call("hdel", KEYS[2], least[1])
+redis.call("zadd", KEYS[1], min + n, item)
+redis.call("hset", KEYS[2], item, min)
+return {min + n, min}
+`)
+)
+
+type (
+	// A TopK finds the k items with the most counts, like hot keys, with the
+	// Space-Saving algorithm. Counts are overestimated by at most Error,
+	// an item with a real count over total/k is always in the top k.
+	TopK struct {
+		k     int
+		store topKProvider
+		// alert is the *topKAlert set by SetAlert.
+		alert atomic.Value
+	}
+
+	// Item is an item of a TopK.
+	Item struct {
+		Key   string
+		Count uint64
+		// Error is how much Count may exceed the real count.
+		Error uint64
+	}
+
+	topKAlert struct {
+		threshold uint64
+		fn        func(Item)
+	}
+
+	topKProvider interface {
+		incr(ctx context.Context, k int, key string, n uint64) (Item, error)
+		list(ctx context.Context) ([]Item, error)
+		reset(ctx context.Context) error
+	}
+)
+
+// NewTopK creates a redis backed TopK of k items, store is the backed redis,
+// key is the key for the counts in a sorted set, errors are in key:error.
+func NewTopK(store *redis.Client, key string, k int) (*TopK, error) {
+	if k <= 0 {
+		return nil, ErrInvalidTopK
+	}
+
+	return &TopK{
+		k: k,
+		store: &redisTopK{
+			store: store,
+			key:   key,
+		},
+	}, nil
+}
+
+// NewLocalTopK creates an in-process TopK of k items.
+func NewLocalTopK(k int) (*TopK, error) {
+	if k <= 0 {
+		return nil, ErrInvalidTopK
+	}
+
+	return &TopK{
+		k: k,
+		store: &localTopK{
+			items: make(map[string]*topKEntry, k),
+		},
+	}, nil
+}
+
+// SetAlert makes Incr call fn when the guaranteed count of an item, Count-Error,
+// reaches threshold, like when a key turns hot. A nil fn removes the alert.
+func (t *TopK) SetAlert(threshold uint64, fn func(Item)) {
+	if fn == nil {
+		t.alert.Store((*topKAlert)(nil))
+		return
+	}
+
+	t.alert.Store(&topKAlert{
+		threshold: threshold,
+		fn:        fn,
+	})
+}
+
+// Incr counts key n times, and returns its estimated count.
+func (t *TopK) Incr(key string, n uint64) (Item, error) {
+	return t.IncrCtx(context.Background(), key, n)
+}
+
+// IncrCtx counts key n times with context.
+func (t *TopK) IncrCtx(ctx context.Context, key string, n uint64) (Item, error) {
+	item, err := t.store.incr(ctx, t.k, key, n)
+	if err != nil {
+		return Item{}, err
+	}
+
+	if alert, ok := t.alert.Load().(*topKAlert); ok && alert != nil {
+		// only the increment can be guaranteed, the rest is inherited as the error
+		guaranteed := item.Count - item.Error
+		if guaranteed >= alert.threshold && guaranteed-n < alert.threshold {
+			alert.fn(item)
+		}
+	}
+
+	return item, nil
+}
+
+// List returns the items by count in descending order.
+func (t *TopK) List() ([]Item, error) {
+	return t.ListCtx(context.Background())
+}
+
+// ListCtx returns the items by count in descending order with context.
+func (t *TopK) ListCtx(ctx context.Context) ([]Item, error) {
+	return t.store.list(ctx)
+}
+
+// Reset clears all counts, like at the start of a new time window.
+func (t *TopK) Reset() error {
+	return t.ResetCtx(context.Background())
+}
+
+// ResetCtx clears all counts with context.
+func (t *TopK) ResetCtx(ctx context.Context) error {
+	return t.store.reset(ctx)
+}
+
+type redisTopK struct {
+	store *redis.Client
+	key   string
+}
+
+func (r *redisTopK) incr(ctx context.Context, k int, key string, n uint64) (Item, error) {
+	resp, err := topKIncrScript.Run(ctx, r.store, []string{r.key, r.key + errorSuffix},
+		strconv.Itoa(k), key, strconv.FormatUint(n, 10)).Int64Slice()
+	if err != nil {
+		return Item{}, err
+	}
+	if len(resp) != 2 {
+		return Item{}, errors.New("unexpected top-k response")
+	}
+
+	return Item{
+		Key:   key,
+		Count: uint64(resp[0]),
+		Error: uint64(resp[1]),
+	}, nil
+}
+
+func (r *redisTopK) list(ctx context.Context) ([]Item, error) {
+	counts, err := r.store.ZRevRangeWithScores(ctx, r.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(counts))
+	for i, count := range counts {
+		keys[i] = count.Member.(string)
+	}
+	errs, err := r.store.HMGet(ctx, r.key+errorSuffix, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, len(counts))
+	for i, count := range counts {
+		items[i] = Item{
+			Key:   keys[i],
+			Count: uint64(count.Score),
+		}
+		if s, ok := errs[i].(string); ok {
+			items[i].Error, _ = strconv.ParseUint(s, 10, 64)
+		}
+	}
+
+	return items, nil
+}
+
+func (r *redisTopK) reset(ctx context.Context) error {
+	return r.store.Del(ctx, r.key, r.key+errorSuffix).Err()
+}
+
+type (
+	localTopK struct {
+		lock  sync.Mutex
+		items map[string]*topKEntry
+		// heap orders the entries by count, the least is at 0.
+		heap topKHeap
+	}
+
+	topKEntry struct {
+		Item
+		index int
+	}
+
+	topKHeap []*topKEntry
+)
+
+func (l *localTopK) incr(_ context.Context, k int, key string, n uint64) (Item, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if entry, ok := l.items[key]; ok {
+		entry.Count += n
+		heap.Fix(&l.heap, entry.index)
+		return entry.Item, nil
+	}
+
+	if len(l.heap) < k {
+		entry := &topKEntry{Item: Item{Key: key, Count: n}}
+		heap.Push(&l.heap, entry)
+		l.items[key] = entry
+		return entry.Item, nil
+	}
+
+	// replace the least item
+	entry := l.heap[0]
+	delete(l.items, entry.Key)
+	entry.Item = Item{
+		Key:   key,
+		Count: entry.Count + n,
+		Error: entry.Count,
+	}
+	heap.Fix(&l.heap, 0)
+	l.items[key] = entry
+
+	return entry.Item, nil
+}
+
+func (l *localTopK) list(_ context.Context) ([]Item, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	items := make([]Item, len(l.heap))
+	for i, entry := range l.heap {
+		items[i] = entry.Item
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Count > items[j].Count
+	})
+
+	return items, nil
+}
+
+func (l *localTopK) reset(_ context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.items = make(map[string]*topKEntry, len(l.items))
+	l.heap = nil
+
+	return nil
+}
+
+func (h topKHeap) Len() int {
+	return len(h)
+}
+
+func (h topKHeap) Less(i, j int) bool {
+	return h[i].Count < h[j].Count
+}
+
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	entry := x.(*topKEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}